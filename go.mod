@@ -2,4 +2,10 @@ module github.com/doganarif/blast
 
 go 1.25.0
 
-require golang.org/x/sys v0.37.0
+require (
+	github.com/andybalholm/brotli v1.2.0
+	golang.org/x/net v0.46.0
+	golang.org/x/sys v0.37.0
+)
+
+require golang.org/x/text v0.30.0 // indirect
@@ -11,6 +11,8 @@ import (
 	"os"
 	"path/filepath"
 	"time"
+
+	"github.com/doganarif/blast/internal/config"
 )
 
 const (
@@ -112,6 +114,13 @@ func generateCA(caDir string) (*CA, error) {
 		return nil, fmt.Errorf("failed to write private key: %w", err)
 	}
 
+	// Keep the CA usable by the invoking user when created through sudo
+	for _, path := range []string{caDir, certPath, keyPath} {
+		if err := config.ChownToUser(path); err != nil {
+			return nil, fmt.Errorf("failed to set CA file owner: %w", err)
+		}
+	}
+
 	return &CA{
 		Cert:    cert,
 		Key:     privateKey,
@@ -174,12 +183,12 @@ func (ca *CA) GetCertPath() string {
 
 // getCADir returns the directory where CA files are stored
 func getCADir() (string, error) {
-	homeDir, err := os.UserHomeDir()
+	stateDir, err := config.StateDir()
 	if err != nil {
 		return "", err
 	}
 
-	return filepath.Join(homeDir, ".config", "blast", "ca"), nil
+	return filepath.Join(stateDir, "ca"), nil
 }
 
 // fileExists checks if a file exists
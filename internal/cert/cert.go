@@ -14,8 +14,13 @@ import (
 	"github.com/doganarif/blast/internal/ca"
 )
 
-// GenerateCertificate creates a new certificate for the given domain
-func GenerateCertificate(rootCA *ca.CA, domain string) (tls.Certificate, error) {
+// GenerateCertificate creates a new certificate for the given domains. The
+// first domain is the common name; all of them are SANs.
+func GenerateCertificate(rootCA *ca.CA, domains ...string) (tls.Certificate, error) {
+	if len(domains) == 0 {
+		return tls.Certificate{}, fmt.Errorf("no domains given")
+	}
+
 	// Generate private key for the domain
 	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
@@ -32,9 +37,9 @@ func GenerateCertificate(rootCA *ca.CA, domain string) (tls.Certificate, error)
 		SerialNumber: serialNumber,
 		Subject: pkix.Name{
 			Organization: []string{"BlastProxy"},
-			CommonName:   domain,
+			CommonName:   domains[0],
 		},
-		DNSNames:    []string{domain},
+		DNSNames:    domains,
 		NotBefore:   time.Now(),
 		NotAfter:    time.Now().AddDate(1, 0, 0), // Valid for 1 year
 		KeyUsage:    x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature,
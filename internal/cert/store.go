@@ -0,0 +1,156 @@
+package cert
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/doganarif/blast/internal/ca"
+	"github.com/doganarif/blast/internal/config"
+)
+
+// RenewBefore is how long before expiry a stored certificate is reissued
+const RenewBefore = 30 * 24 * time.Hour
+
+// Store keeps issued leaf certificates under the CA directory, so daemon
+// restarts and reloads reuse them instead of generating new keys. Entries
+// are keyed by the set of hostnames on the certificate. Get is safe to
+// call concurrently; callers issuing the same names should coordinate to
+// avoid generating duplicate keys.
+type Store struct {
+	rootCA *ca.CA
+	dir    string
+}
+
+// NewStore creates a store for certificates signed by rootCA
+func NewStore(rootCA *ca.CA) *Store {
+	return &Store{
+		rootCA: rootCA,
+		dir:    filepath.Join(rootCA.Path, "leaves"),
+	}
+}
+
+// Get returns a certificate for the domains, reusing the stored one while
+// it is valid for the same names, signed by the current CA and not due
+// for renewal. Otherwise a new one is issued and stored.
+func (s *Store) Get(domains ...string) (tls.Certificate, error) {
+	if len(domains) == 0 {
+		return tls.Certificate{}, fmt.Errorf("no domains given")
+	}
+
+	domains = slices.Clone(domains)
+	for i, d := range domains {
+		domains[i] = strings.ToLower(d)
+	}
+
+	path := s.path(domains)
+	if cert, err := s.load(path, domains); err == nil && !NeedsRenewal(cert) {
+		return cert, nil
+	}
+
+	cert, err := GenerateCertificate(s.rootCA, domains...)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	if err := s.save(path, cert); err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to store certificate: %w", err)
+	}
+	return cert, nil
+}
+
+// NeedsRenewal reports whether a certificate expires within RenewBefore
+func NeedsRenewal(cert tls.Certificate) bool {
+	return cert.Leaf == nil || time.Until(cert.Leaf.NotAfter) < RenewBefore
+}
+
+// path returns the file for a set of lower case domains. Order doesn't
+// matter; one name is kept readable for people browsing the directory.
+func (s *Store) path(domains []string) string {
+	names := slices.Sorted(slices.Values(domains))
+
+	sum := sha256.Sum256([]byte(strings.Join(names, ",")))
+	readable := strings.ReplaceAll(names[0], "*", "_")
+	return filepath.Join(s.dir, readable+"-"+hex.EncodeToString(sum[:8])+".pem")
+}
+
+// load reads a stored certificate and checks that it still matches
+func (s *Store) load(path string, domains []string) (tls.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	// The CA may have been regenerated since the leaf was issued
+	roots := x509.NewCertPool()
+	roots.AddCert(s.rootCA.Cert)
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{Roots: roots}); err != nil {
+		return tls.Certificate{}, err
+	}
+
+	want := slices.Clone(domains)
+	have := slices.Clone(cert.Leaf.DNSNames)
+	slices.Sort(want)
+	slices.Sort(have)
+	if !slices.Equal(want, have) {
+		return tls.Certificate{}, fmt.Errorf("stored certificate is for %v", cert.Leaf.DNSNames)
+	}
+
+	return cert, nil
+}
+
+// save writes the chain and key to a single owner-only file
+func (s *Store) save(path string, cert tls.Certificate) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	if err := config.ChownToUser(s.dir); err != nil {
+		return err
+	}
+
+	key, err := x509.MarshalPKCS8PrivateKey(cert.PrivateKey)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	for _, der := range cert.Certificate {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+	pem.Encode(&buf, &pem.Block{Type: "PRIVATE KEY", Bytes: key})
+
+	// Write to a temp file first so a crash never leaves half a key behind.
+	// CreateTemp makes it owner-only and unique, so parallel saves don't
+	// collide.
+	tmp, err := os.CreateTemp(s.dir, ".leaf-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(buf.Bytes())
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = config.ChownToUser(tmp.Name())
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -2,24 +2,134 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+
+	"golang.org/x/net/http/httpguts"
+)
+
+// PathRule routes requests under a path prefix to a different local port
+type PathRule struct {
+	Prefix      string `json:"prefix"`
+	LocalPort   string `json:"local_port"`
+	StripPrefix bool   `json:"strip_prefix,omitempty"`
+	HealthPath  string `json:"health_path,omitempty"` // empty: TCP connect check
+}
+
+// Header rule directions and actions
+const (
+	HeaderRequest  = "request"
+	HeaderResponse = "response"
+
+	HeaderSet    = "set"
+	HeaderAppend = "append"
+	HeaderRemove = "remove"
+)
+
+// Rewrite modes for upstreams that believe they live on localhost
+const (
+	RewriteOff     = ""
+	RewriteHeaders = "headers" // Location, Content-Location, Refresh and cookies
+	RewriteBody    = "body"    // headers plus absolute URLs in text bodies
 )
 
+// HeaderRule sets, appends or removes a header on proxied traffic. Values
+// may use the placeholders {client_ip}, {route} and {request_id}.
+type HeaderRule struct {
+	Direction string `json:"direction"` // request or response
+	Action    string `json:"action"`    // set, append or remove
+	Name      string `json:"name"`
+	Value     string `json:"value,omitempty"`
+}
+
 // ProxyMapping represents an active proxy configuration
 type ProxyMapping struct {
-	DomainPrefix string `json:"domain_prefix"`
-	LocalPort    string `json:"local_port"`
-	FullDomain   string `json:"full_domain"`
+	DomainPrefix    string       `json:"domain_prefix"`
+	LocalPort       string       `json:"local_port"`
+	FullDomain      string       `json:"full_domain"`                // *.name.blast for wildcard routes
+	TLD             string       `json:"tld,omitempty"`              // empty: the global TLD
+	Aliases         []string     `json:"aliases,omitempty"`          // extra hostnames, any domain
+	Paths           []PathRule   `json:"paths,omitempty"`            // ordered; longest prefix wins
+	HealthPath      string       `json:"health_path,omitempty"`      // empty: TCP connect check
+	RetryGrace      string       `json:"retry_grace,omitempty"`      // e.g. "3s"; empty: fail immediately
+	Headers         []HeaderRule `json:"headers,omitempty"`          // applied in order
+	Rewrite         string       `json:"rewrite,omitempty"`          // see Rewrite* constants
+	SubdomainHeader string       `json:"subdomain_header,omitempty"` // wildcard routes; empty: X-Subdomain
+}
+
+// Hostnames returns every name the mapping answers to, FullDomain first
+func (m ProxyMapping) Hostnames() []string {
+	return append([]string{m.FullDomain}, m.Aliases...)
+}
+
+// DefaultSubdomainHeader is the request header that tells the upstream of
+// a wildcard route which subdomain was requested
+const DefaultSubdomainHeader = "X-Subdomain"
+
+// IsWildcard reports whether a domain is a wildcard route such as
+// *.app.blast, which matches any single label in place of the asterisk
+func IsWildcard(domain string) bool {
+	return strings.HasPrefix(domain, "*.")
+}
+
+// Default listener ports; HTTPPortOff disables the HTTP redirect listener
+const (
+	DefaultHTTPSPort = "443"
+	DefaultHTTPPort  = "80"
+	HTTPPortOff      = "off"
+)
+
+// Name resolution backends; see the hosts package
+const (
+	ResolverHosts          = "hosts"          // entries in the hosts file
+	ResolverDnsmasq        = "dnsmasq"        // address lines in /etc/dnsmasq.d
+	ResolverNetworkManager = "networkmanager" // address lines for NetworkManager's dnsmasq
+	ResolverResolved       = "resolved"       // systemd-resolved sends the zone to the DNS server
+	ResolverNone           = "none"           // managed outside Blast
+)
+
+// DefaultTLD is the suffix routes get unless another one is configured
+const DefaultTLD = "blast"
+
+// dashboardLabel names the traffic inspector's host under the global TLD
+const dashboardLabel = "blast"
+
+// DashboardDomain returns the reserved host serving the traffic inspector
+// when routes end in tld, such as blast.blast or blast.test
+func DashboardDomain(tld string) string {
+	return dashboardLabel + "." + tld
+}
+
+// reservedTLDs are suffixes that can never be delegated on the public
+// internet (RFC 2606, RFC 6761, RFC 8375 and ICANN's .internal)
+var reservedTLDs = []string{"test", "localhost", "example", "invalid", "internal", "home.arpa"}
+
+// Rename records a route whose full domain changed
+type Rename struct {
+	Old string
+	New string
 }
 
 // Config represents the persistent configuration
 type Config struct {
-	CAPath       string                   `json:"ca_path"`
-	Proxies      map[string]ProxyMapping  `json:"proxies"` // key: domain_prefix
-	mu           sync.RWMutex
-	path         string
+	CAPath        string                  `json:"ca_path"`
+	Proxies       map[string]ProxyMapping `json:"proxies"`                  // key: domain_prefix
+	HTTPSPort     string                  `json:"https_port,omitempty"`     // empty: 443
+	HTTPPort      string                  `json:"http_port,omitempty"`      // redirect listener; empty: 80
+	BindAddresses []string                `json:"bind_addresses,omitempty"` // empty: all interfaces
+	DNSAddr       string                  `json:"dns_addr,omitempty"`       // DNS responder; empty: off
+	Resolver      string                  `json:"resolver,omitempty"`       // see Resolver* constants; empty: hosts
+	TLD           string                  `json:"tld,omitempty"`            // suffix for new routes; empty: blast
+	mu            sync.RWMutex
+	path          string
 }
 
 // Load reads the configuration from disk
@@ -47,6 +157,7 @@ func Load() (*Config, error) {
 		return nil, err
 	}
 
+	cfg.canonicalizeKeys()
 	return cfg, nil
 }
 
@@ -64,24 +175,169 @@ func (c *Config) Save() error {
 	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
 		return err
 	}
+	if err := ChownToUser(filepath.Dir(c.path)); err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(c.path, data, 0644); err != nil {
+		return err
+	}
+	return ChownToUser(c.path)
+}
+
+// AddProxy adds a new proxy mapping. The prefix is validated and Unicode
+// labels are stored as punycode.
+func (c *Config) AddProxy(prefix, port string) error {
+	prefix, err := ToASCII(prefix)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Keep per-route settings when an existing proxy is re-pointed at a new port
+	mapping := c.Proxies[prefix]
+	mapping.DomainPrefix = prefix
+	mapping.LocalPort = port
+	mapping.FullDomain = prefix + "." + c.routeTLD(mapping)
+
+	c.Proxies[prefix] = mapping
+	return nil
+}
+
+// AddPathRule adds or replaces a path rule on an existing proxy
+func (c *Config) AddPathRule(prefix string, rule PathRule) error {
+	prefix = routeKey(prefix)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mapping, exists := c.Proxies[prefix]
+	if !exists {
+		return fmt.Errorf("no proxy configured for %s", prefix)
+	}
+
+	if !strings.HasPrefix(rule.Prefix, "/") {
+		return fmt.Errorf("path prefix must start with /: %s", rule.Prefix)
+	}
+
+	if rule.LocalPort == "" {
+		return fmt.Errorf("path rule %s needs a local port", rule.Prefix)
+	}
+
+	// Copy so readers holding the old mapping never see the slice change
+	paths := make([]PathRule, 0, len(mapping.Paths)+1)
+	replaced := false
+	for _, p := range mapping.Paths {
+		if p.Prefix == rule.Prefix {
+			p = rule
+			replaced = true
+		}
+		paths = append(paths, p)
+	}
+	if !replaced {
+		paths = append(paths, rule)
+	}
+
+	mapping.Paths = paths
+	c.Proxies[prefix] = mapping
+	return nil
+}
+
+// AddAlias adds an extra hostname to an existing proxy, such as
+// api.acme.test. Aliases share the proxy's certificate and settings.
+func (c *Config) AddAlias(prefix, hostname string) error {
+	prefix = routeKey(prefix)
+
+	hostname, err := validateHostname(hostname)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mapping, exists := c.Proxies[prefix]
+	if !exists {
+		return fmt.Errorf("no proxy configured for %s", prefix)
+	}
 
-	return os.WriteFile(c.path, data, 0644)
+	for _, other := range c.Proxies {
+		if slices.Contains(other.Hostnames(), hostname) {
+			if other.DomainPrefix == prefix {
+				return nil
+			}
+			return fmt.Errorf("%s is already used by %s", hostname, other.FullDomain)
+		}
+	}
+
+	mapping.Aliases = append(mapping.Aliases, hostname)
+	c.Proxies[prefix] = mapping
+	return nil
 }
 
-// AddProxy adds a new proxy mapping
-func (c *Config) AddProxy(prefix, port string) {
+// RemoveAlias removes an extra hostname from an existing proxy
+func (c *Config) RemoveAlias(prefix, hostname string) error {
+	prefix = routeKey(prefix)
+
+	if ascii, err := ToASCII(hostname); err == nil {
+		hostname = ascii
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.Proxies[prefix] = ProxyMapping{
-		DomainPrefix: prefix,
-		LocalPort:    port,
-		FullDomain:   prefix + ".blast",
+	mapping, exists := c.Proxies[prefix]
+	if !exists {
+		return fmt.Errorf("no proxy configured for %s", prefix)
 	}
+
+	i := slices.Index(mapping.Aliases, hostname)
+	if i < 0 {
+		return fmt.Errorf("no alias %s on %s", hostname, mapping.FullDomain)
+	}
+
+	mapping.Aliases = slices.Delete(mapping.Aliases, i, i+1)
+	c.Proxies[prefix] = mapping
+	return nil
+}
+
+// RemovePathRule removes a path rule from an existing proxy
+func (c *Config) RemovePathRule(prefix, pathPrefix string) error {
+	prefix = routeKey(prefix)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mapping, exists := c.Proxies[prefix]
+	if !exists {
+		return fmt.Errorf("no proxy configured for %s", prefix)
+	}
+
+	paths := make([]PathRule, 0, len(mapping.Paths))
+	found := false
+	for _, p := range mapping.Paths {
+		if p.Prefix == pathPrefix {
+			found = true
+			continue
+		}
+		paths = append(paths, p)
+	}
+
+	if !found {
+		return fmt.Errorf("no path rule %s on %s", pathPrefix, prefix)
+	}
+
+	mapping.Paths = paths
+	c.Proxies[prefix] = mapping
+	return nil
 }
 
 // RemoveProxy removes a proxy mapping
 func (c *Config) RemoveProxy(prefix string) {
+	prefix = routeKey(prefix)
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -90,6 +346,8 @@ func (c *Config) RemoveProxy(prefix string) {
 
 // GetProxy retrieves a proxy mapping
 func (c *Config) GetProxy(prefix string) (ProxyMapping, bool) {
+	prefix = routeKey(prefix)
+
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
@@ -109,6 +367,338 @@ func (c *Config) ListProxies() []ProxyMapping {
 	return proxies
 }
 
+// AddHeaderRule appends a header rewrite rule to an existing proxy
+func (c *Config) AddHeaderRule(prefix string, rule HeaderRule) error {
+	prefix = routeKey(prefix)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mapping, exists := c.Proxies[prefix]
+	if !exists {
+		return fmt.Errorf("no proxy configured for %s", prefix)
+	}
+
+	if rule.Direction != HeaderRequest && rule.Direction != HeaderResponse {
+		return fmt.Errorf("header rule direction must be %s or %s: %s", HeaderRequest, HeaderResponse, rule.Direction)
+	}
+
+	switch rule.Action {
+	case HeaderSet, HeaderAppend:
+	case HeaderRemove:
+		rule.Value = ""
+	default:
+		return fmt.Errorf("header rule action must be %s, %s or %s: %s", HeaderSet, HeaderAppend, HeaderRemove, rule.Action)
+	}
+
+	if !httpguts.ValidHeaderFieldName(rule.Name) {
+		return fmt.Errorf("invalid header name: %q", rule.Name)
+	}
+	if !httpguts.ValidHeaderFieldValue(rule.Value) {
+		return fmt.Errorf("invalid header value: %q", rule.Value)
+	}
+
+	headers := make([]HeaderRule, 0, len(mapping.Headers)+1)
+	headers = append(headers, mapping.Headers...)
+	mapping.Headers = append(headers, rule)
+	c.Proxies[prefix] = mapping
+	return nil
+}
+
+// RemoveHeaderRule removes every rule for a header in one direction
+func (c *Config) RemoveHeaderRule(prefix, direction, name string) error {
+	prefix = routeKey(prefix)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mapping, exists := c.Proxies[prefix]
+	if !exists {
+		return fmt.Errorf("no proxy configured for %s", prefix)
+	}
+
+	headers := make([]HeaderRule, 0, len(mapping.Headers))
+	for _, h := range mapping.Headers {
+		if h.Direction == direction && strings.EqualFold(h.Name, name) {
+			continue
+		}
+		headers = append(headers, h)
+	}
+
+	if len(headers) == len(mapping.Headers) {
+		return fmt.Errorf("no %s header rule for %s on %s", direction, name, prefix)
+	}
+
+	mapping.Headers = headers
+	c.Proxies[prefix] = mapping
+	return nil
+}
+
+// SetHealthPath sets the HTTP path used to health-check a proxy's upstream
+func (c *Config) SetHealthPath(prefix, path string) error {
+	prefix = routeKey(prefix)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mapping, exists := c.Proxies[prefix]
+	if !exists {
+		return fmt.Errorf("no proxy configured for %s", prefix)
+	}
+
+	if path != "" && !strings.HasPrefix(path, "/") {
+		return fmt.Errorf("health path must start with /: %s", path)
+	}
+
+	mapping.HealthPath = path
+	c.Proxies[prefix] = mapping
+	return nil
+}
+
+// SetRetryGrace sets how long requests are held while a proxy's upstream
+// refuses connections, e.g. during a dev server restart. Zero disables it.
+func (c *Config) SetRetryGrace(prefix string, grace time.Duration) error {
+	prefix = routeKey(prefix)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mapping, exists := c.Proxies[prefix]
+	if !exists {
+		return fmt.Errorf("no proxy configured for %s", prefix)
+	}
+
+	if grace < 0 {
+		return fmt.Errorf("retry grace must not be negative: %s", grace)
+	}
+
+	mapping.RetryGrace = ""
+	if grace > 0 {
+		mapping.RetryGrace = grace.String()
+	}
+	c.Proxies[prefix] = mapping
+	return nil
+}
+
+// SetRewrite sets how a proxy rewrites localhost URLs from its upstream
+func (c *Config) SetRewrite(prefix, mode string) error {
+	prefix = routeKey(prefix)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mapping, exists := c.Proxies[prefix]
+	if !exists {
+		return fmt.Errorf("no proxy configured for %s", prefix)
+	}
+
+	switch mode {
+	case RewriteOff, RewriteHeaders, RewriteBody:
+	default:
+		return fmt.Errorf("unknown rewrite mode: %s", mode)
+	}
+
+	mapping.Rewrite = mode
+	c.Proxies[prefix] = mapping
+	return nil
+}
+
+// SetSubdomainHeader sets the header that carries the matched subdomain
+// of a wildcard route. An empty name restores DefaultSubdomainHeader.
+func (c *Config) SetSubdomainHeader(prefix, header string) error {
+	prefix = routeKey(prefix)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mapping, exists := c.Proxies[prefix]
+	if !exists {
+		return fmt.Errorf("no proxy configured for %s", prefix)
+	}
+	if !IsWildcard(mapping.FullDomain) {
+		return fmt.Errorf("%s is not a wildcard route", mapping.FullDomain)
+	}
+
+	mapping.SubdomainHeader = http.CanonicalHeaderKey(header)
+	c.Proxies[prefix] = mapping
+	return nil
+}
+
+// ValidateTLD checks that tld is a reserved name that can't clash with a
+// real domain. The historical default, blast, is still accepted.
+func ValidateTLD(tld string) error {
+	if tld == DefaultTLD || slices.Contains(reservedTLDs, tld) {
+		return nil
+	}
+	if tld == "local" {
+		return fmt.Errorf(".local is reserved for multicast DNS; use one of %s", strings.Join(reservedTLDs, ", "))
+	}
+	return fmt.Errorf(".%s is not a reserved TLD and may resolve publicly; use one of %s", tld, strings.Join(reservedTLDs, ", "))
+}
+
+// normalizeTLD lowercases a TLD and strips surrounding dots
+func normalizeTLD(tld string) string {
+	return strings.Trim(strings.ToLower(tld), ".")
+}
+
+// SetTLD sets the suffix for routes added from now on. Use MigrateTLD to
+// move existing routes as well.
+func (c *Config) SetTLD(tld string) error {
+	tld = normalizeTLD(tld)
+	if tld != "" {
+		if err := ValidateTLD(tld); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.TLD = tld
+	return nil
+}
+
+// GetTLD returns the suffix for new routes
+func (c *Config) GetTLD() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.globalTLD()
+}
+
+// SetRouteTLD gives one route its own suffix and renames it. An empty TLD
+// makes the route follow the global one again.
+func (c *Config) SetRouteTLD(prefix, tld string) (Rename, error) {
+	prefix = routeKey(prefix)
+
+	tld = normalizeTLD(tld)
+	if tld != "" {
+		if err := ValidateTLD(tld); err != nil {
+			return Rename{}, err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mapping, exists := c.Proxies[prefix]
+	if !exists {
+		return Rename{}, fmt.Errorf("no proxy configured for %s", prefix)
+	}
+
+	mapping.TLD = tld
+	rename := c.rename(&mapping)
+	c.Proxies[prefix] = mapping
+	return rename, nil
+}
+
+// MigrateTLD changes the global suffix and renames every route that
+// follows it, along with aliases and the dashboard host under the old
+// suffix once no route keeps it. The returned renames tell the caller
+// which hosts entries to move; certificates follow the new names when the
+// daemon reloads. Nothing changes if a renamed alias would clash with
+// another hostname.
+func (c *Config) MigrateTLD(tld string) ([]Rename, error) {
+	tld = normalizeTLD(tld)
+	if err := ValidateTLD(tld); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	old := c.globalTLD()
+	if old == tld {
+		c.TLD = tld
+		return nil, nil
+	}
+
+	// Aliases under a suffix some route still uses keep being served
+	renameAliases := true
+	for _, mapping := range c.Proxies {
+		if mapping.TLD == old {
+			renameAliases = false
+		}
+	}
+
+	proxies := make(map[string]ProxyMapping, len(c.Proxies))
+	var renames []Rename
+	for prefix, mapping := range c.Proxies {
+		if mapping.TLD == "" {
+			fullDomain := mapping.DomainPrefix + "." + tld
+			renames = append(renames, Rename{Old: mapping.FullDomain, New: fullDomain})
+			mapping.FullDomain = fullDomain
+		}
+
+		if renameAliases {
+			mapping.Aliases = slices.Clone(mapping.Aliases)
+			for i, alias := range mapping.Aliases {
+				if base, ok := strings.CutSuffix(alias, "."+old); ok {
+					mapping.Aliases[i] = base + "." + tld
+					renames = append(renames, Rename{Old: alias, New: mapping.Aliases[i]})
+				}
+			}
+		}
+		proxies[prefix] = mapping
+	}
+
+	owners := make(map[string]string)
+	for _, mapping := range proxies {
+		for _, name := range mapping.Hostnames() {
+			if other, ok := owners[name]; ok {
+				return nil, fmt.Errorf("%s would be used by both %s and %s", name, other, mapping.FullDomain)
+			}
+			owners[name] = mapping.FullDomain
+		}
+	}
+	if owner, ok := owners[DashboardDomain(tld)]; ok {
+		return nil, fmt.Errorf("%s is reserved for the traffic inspector but used by %s", DashboardDomain(tld), owner)
+	}
+
+	c.TLD = tld
+	c.Proxies = proxies
+	return append(renames, Rename{Old: DashboardDomain(old), New: DashboardDomain(tld)}), nil
+}
+
+// Zones returns every TLD in use: the global one and any per-route ones
+func (c *Config) Zones() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	zones := []string{c.globalTLD()}
+	for _, mapping := range c.Proxies {
+		if mapping.TLD != "" && !slices.Contains(zones, mapping.TLD) {
+			zones = append(zones, mapping.TLD)
+		}
+	}
+	return zones
+}
+
+// globalTLD returns the configured suffix or the default. The caller must
+// hold mu.
+func (c *Config) globalTLD() string {
+	if c.TLD == "" {
+		return DefaultTLD
+	}
+	return c.TLD
+}
+
+// routeTLD returns the suffix a mapping uses. The caller must hold mu.
+func (c *Config) routeTLD(mapping ProxyMapping) string {
+	if mapping.TLD != "" {
+		return mapping.TLD
+	}
+	return c.globalTLD()
+}
+
+// rename recomputes a mapping's full domain from its prefix and TLD. The
+// caller must hold mu.
+func (c *Config) rename(mapping *ProxyMapping) Rename {
+	old := mapping.FullDomain
+	mapping.FullDomain = mapping.DomainPrefix + "." + c.routeTLD(*mapping)
+	return Rename{Old: old, New: mapping.FullDomain}
+}
+
 // SetCAPath sets the CA certificate path
 func (c *Config) SetCAPath(path string) {
 	c.mu.Lock()
@@ -117,14 +707,178 @@ func (c *Config) SetCAPath(path string) {
 	c.CAPath = path
 }
 
-// getConfigPath returns the platform-specific config file path
-func getConfigPath() (string, error) {
-	homeDir, err := os.UserHomeDir()
+// SetHTTPSPort sets the port of the HTTPS listener. An empty port restores
+// the default.
+func (c *Config) SetHTTPSPort(port string) error {
+	if port != "" {
+		if err := validatePort(port); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.HTTPSPort = port
+	return nil
+}
+
+// GetHTTPSPort returns the HTTPS listener port
+func (c *Config) GetHTTPSPort() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.HTTPSPort == "" {
+		return DefaultHTTPSPort
+	}
+	return c.HTTPSPort
+}
+
+// SetHTTPPort sets the port of the HTTP to HTTPS redirect listener. An
+// empty port restores the default and HTTPPortOff disables the listener.
+func (c *Config) SetHTTPPort(port string) error {
+	if port != "" && port != HTTPPortOff {
+		if err := validatePort(port); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.HTTPPort = port
+	return nil
+}
+
+// GetHTTPPort returns the redirect listener port, or HTTPPortOff
+func (c *Config) GetHTTPPort() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.HTTPPort == "" {
+		return DefaultHTTPPort
+	}
+	return c.HTTPPort
+}
+
+// SetBindAddresses sets the IP addresses the listeners bind to, such as
+// 127.0.0.1, a LAN address or ::1. No addresses means all interfaces.
+func (c *Config) SetBindAddresses(addrs []string) error {
+	for _, addr := range addrs {
+		if net.ParseIP(addr) == nil {
+			return fmt.Errorf("invalid bind address: %s", addr)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.BindAddresses = append([]string(nil), addrs...)
+	return nil
+}
+
+// GetBindAddresses returns the listener bind addresses. An empty string
+// stands for all interfaces.
+func (c *Config) GetBindAddresses() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if len(c.BindAddresses) == 0 {
+		return []string{""}
+	}
+	return append([]string(nil), c.BindAddresses...)
+}
+
+// SetDNSAddr sets the ip:port the built-in DNS responder listens on. An
+// empty address turns the responder off.
+func (c *Config) SetDNSAddr(addr string) error {
+	if addr != "" {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || net.ParseIP(host) == nil {
+			return fmt.Errorf("invalid DNS address: %s", addr)
+		}
+		if err := validatePort(port); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.DNSAddr = addr
+	return nil
+}
+
+// GetDNSAddr returns the DNS responder address, or "" when it is off
+func (c *Config) GetDNSAddr() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.DNSAddr
+}
+
+// SetResolver selects the name resolution backend. An empty name restores
+// the hosts file.
+func (c *Config) SetResolver(name string) error {
+	switch name {
+	case "", ResolverHosts, ResolverDnsmasq, ResolverNetworkManager, ResolverResolved, ResolverNone:
+	default:
+		return fmt.Errorf("unknown resolver backend: %s", name)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Resolver = name
+	return nil
+}
+
+// GetResolver returns the name resolution backend
+func (c *Config) GetResolver() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.Resolver == "" {
+		return ResolverHosts
+	}
+	return c.Resolver
+}
+
+// URL returns the public URL of a domain, including the HTTPS port when it
+// isn't the default
+func (c *Config) URL(domain string) string {
+	if port := c.GetHTTPSPort(); port != DefaultHTTPSPort {
+		return "https://" + net.JoinHostPort(domain, port)
+	}
+	return "https://" + domain
+}
+
+// validateHostname checks that name is a fully qualified hostname,
+// optionally a wildcard such as *.app.blast, and returns its ASCII form
+func validateHostname(name string) (string, error) {
+	ascii, err := ToASCII(name)
 	if err != nil {
 		return "", err
 	}
+	if !strings.Contains(strings.TrimPrefix(ascii, "*."), ".") {
+		return "", fmt.Errorf("invalid hostname %q: no domain", name)
+	}
+	return ascii, nil
+}
+
+// validatePort checks that port is a valid TCP port number
+func validatePort(port string) error {
+	if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("invalid port: %s", port)
+	}
+	return nil
+}
 
-	// Use platform-specific config directory
-	configDir := filepath.Join(homeDir, ".config", "blast")
+// getConfigPath returns the config file path
+func getConfigPath() (string, error) {
+	configDir, err := StateDir()
+	if err != nil {
+		return "", err
+	}
 	return filepath.Join(configDir, "config.json"), nil
 }
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"slices"
+	"testing"
+)
+
+// newTestConfig returns an empty config that is never saved
+func newTestConfig(t *testing.T) *Config {
+	t.Helper()
+
+	return &Config{Proxies: make(map[string]ProxyMapping)}
+}
+
+func TestAddHeaderRuleValidates(t *testing.T) {
+	c := newTestConfig(t)
+	if err := c.AddProxy("app", "3000"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name, value string
+		ok          bool
+	}{
+		{"X-Env", "dev", true},
+		{"X-Client", "{client_ip}", true},
+		{"", "dev", false},
+		{"X Env", "dev", false},
+		{"X-Env:", "dev", false},
+		{"X-Env", "dev\r\nX-Admin: 1", false},
+		{"X-Env", "dev\x00", false},
+	} {
+		err := c.AddHeaderRule("app", HeaderRule{
+			Direction: HeaderRequest,
+			Action:    HeaderSet,
+			Name:      tc.name,
+			Value:     tc.value,
+		})
+		if (err == nil) != tc.ok {
+			t.Errorf("AddHeaderRule(%q, %q): got error %v, want ok %v", tc.name, tc.value, err, tc.ok)
+		}
+	}
+
+	if got := len(c.Proxies["app"].Headers); got != 2 {
+		t.Errorf("%d rules stored, want 2", got)
+	}
+}
+
+func TestMigrateTLDRenamesAliases(t *testing.T) {
+	c := newTestConfig(t)
+	for _, step := range []error{
+		c.AddProxy("acme", "3000"),
+		c.AddAlias("acme", "acme-api.blast"),
+		c.AddAlias("acme", "*.acme.blast"),
+		c.AddAlias("acme", "acme.example"),
+	} {
+		if step != nil {
+			t.Fatal(step)
+		}
+	}
+
+	renames, err := c.MigrateTLD("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mapping := c.Proxies["acme"]
+	want := []string{"acme.test", "acme-api.test", "*.acme.test", "acme.example"}
+	if got := mapping.Hostnames(); !slices.Equal(got, want) {
+		t.Errorf("hostnames %v, want %v", got, want)
+	}
+
+	wantRenames := []Rename{
+		{Old: "acme.blast", New: "acme.test"},
+		{Old: "acme-api.blast", New: "acme-api.test"},
+		{Old: "*.acme.blast", New: "*.acme.test"},
+		{Old: "blast.blast", New: "blast.test"},
+	}
+	if !slices.Equal(renames, wantRenames) {
+		t.Errorf("renames %v, want %v", renames, wantRenames)
+	}
+}
+
+func TestMigrateTLDRefusesClashes(t *testing.T) {
+	c := newTestConfig(t)
+	for _, step := range []error{
+		c.AddProxy("app", "3000"),
+		c.AddProxy("api", "3001"),
+		c.AddAlias("api", "app.test"),
+	} {
+		if step != nil {
+			t.Fatal(step)
+		}
+	}
+
+	if _, err := c.MigrateTLD("test"); err == nil {
+		t.Fatal("expected a clash between app.test and the alias")
+	}
+	if got := c.Proxies["app"].FullDomain; got != "app.blast" || c.GetTLD() != DefaultTLD {
+		t.Errorf("failed migration changed the config: %s, .%s", got, c.GetTLD())
+	}
+}
+
+func TestCanonicalizeKeys(t *testing.T) {
+	c := newTestConfig(t)
+	c.Proxies["App"] = ProxyMapping{DomainPrefix: "App", LocalPort: "3000", FullDomain: "App.blast"}
+	c.Proxies["münchen"] = ProxyMapping{DomainPrefix: "münchen", LocalPort: "3001", FullDomain: "münchen.blast"}
+	c.canonicalizeKeys()
+
+	for _, prefix := range []string{"App", "app", "münchen"} {
+		if _, ok := c.GetProxy(prefix); !ok {
+			t.Errorf("GetProxy(%q) found nothing", prefix)
+		}
+	}
+
+	c.RemoveProxy("App")
+	if _, ok := c.GetProxy("app"); ok {
+		t.Error("RemoveProxy left the route behind")
+	}
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// hostnameProfile validates and maps hostnames the way browsers do before
+// a lookup, and rejects labels that don't fit in DNS
+var hostnameProfile = idna.New(
+	idna.MapForLookup(),
+	idna.BidiRule(),
+	idna.VerifyDNSLength(true),
+)
+
+// ToASCII validates a hostname or route prefix and converts Unicode labels
+// to punycode, e.g. münchen.blast to xn--mnchen-3ya.blast. The result is
+// lower case. A leading "*." wildcard is kept.
+func ToASCII(name string) (string, error) {
+	wildcard := IsWildcard(name)
+	ascii, err := hostnameProfile.ToASCII(strings.TrimSuffix(strings.TrimPrefix(name, "*."), "."))
+	if err != nil {
+		return "", fmt.Errorf("invalid hostname %q: %w", name, err)
+	}
+
+	if wildcard {
+		ascii = "*." + ascii
+	}
+	return ascii, nil
+}
+
+// ToUnicode converts punycode labels back to Unicode for display. Names
+// that can't be converted are returned as is.
+func ToUnicode(name string) string {
+	wildcard := IsWildcard(name)
+	unicode, err := idna.Display.ToUnicode(strings.TrimPrefix(name, "*."))
+	if err != nil {
+		return name
+	}
+
+	if wildcard {
+		unicode = "*." + unicode
+	}
+	return unicode
+}
+
+// DisplayDomain returns the mapping's full domain in Unicode
+func (m ProxyMapping) DisplayDomain() string {
+	return ToUnicode(m.FullDomain)
+}
+
+// routeKey returns the key a route prefix is stored under. Prefixes that
+// don't convert are looked up as given and simply won't match.
+func routeKey(prefix string) string {
+	if key, err := ToASCII(prefix); err == nil {
+		return key
+	}
+	return prefix
+}
+
+// canonicalizeKeys moves routes saved by versions that stored prefixes as
+// typed, such as "App", to their routeKey so lookups find them. A route
+// whose key is already taken is left where it is.
+func (c *Config) canonicalizeKeys() {
+	for _, prefix := range slices.Sorted(maps.Keys(c.Proxies)) {
+		key := routeKey(prefix)
+		if key == prefix {
+			continue
+		}
+		if _, taken := c.Proxies[key]; taken {
+			log.Printf("Route %s clashes with %s; edit %s to keep one of them", prefix, key, c.path)
+			continue
+		}
+
+		mapping := c.Proxies[prefix]
+		mapping.DomainPrefix = key
+		delete(c.Proxies, prefix)
+		c.Proxies[key] = mapping
+	}
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+
+	"github.com/doganarif/blast/internal/system"
+)
+
+var (
+	stateDirOnce sync.Once
+	stateDir     string
+	stateDirErr  error
+)
+
+// StateDir returns the directory holding Blast's config, CA, PID and log
+// files. In order of preference it is $BLAST_HOME, $XDG_CONFIG_HOME/blast,
+// or ~/.config/blast, where ~ is the home of the user who invoked sudo so
+// that "sudo blast start" and "blast list" share the same state.
+//
+// The first call also moves state an earlier version left under root's
+// home (see migrateRootState), so it is in place before anything reads
+// or creates a config or CA.
+func StateDir() (string, error) {
+	stateDirOnce.Do(func() {
+		stateDir, stateDirErr = resolveStateDir()
+		if stateDirErr == nil {
+			migrateRootState(stateDir)
+		}
+	})
+	return stateDir, stateDirErr
+}
+
+// resolveStateDir works out the state directory from the environment
+func resolveStateDir() (string, error) {
+	if dir := os.Getenv("BLAST_HOME"); dir != "" {
+		return filepath.Abs(dir)
+	}
+
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" && filepath.IsAbs(dir) {
+		return filepath.Join(dir, "blast"), nil
+	}
+
+	return defaultStateDir()
+}
+
+// defaultStateDir returns ~/.config/blast for the user behind sudo
+func defaultStateDir() (string, error) {
+	homeDir, err := userHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".config", "blast"), nil
+}
+
+// userHomeDir returns the home of the user behind sudo, or the current
+// user's home
+func userHomeDir() (string, error) {
+	if name := os.Getenv("SUDO_USER"); name != "" && name != "root" {
+		u, err := user.Lookup(name)
+		if err == nil && u.HomeDir != "" {
+			return u.HomeDir, nil
+		}
+	}
+	return os.UserHomeDir()
+}
+
+// ChownToUser hands a file created while running as root through sudo to
+// the invoking user, so it stays usable without sudo. It does nothing
+// otherwise.
+func ChownToUser(path string) error {
+	uid, gid, ok := system.SudoUser()
+	if !ok || os.Geteuid() != 0 {
+		return nil
+	}
+	return os.Lchown(path, uid, gid)
+}
+
+// migrateRootState moves state written under root's home by versions that
+// ignored sudo into dir. It only runs as root through sudo and when dir
+// is the default ~/.config/blast, not one picked by $BLAST_HOME or
+// $XDG_CONFIG_HOME. A target that already holds a config or CA is left
+// alone rather than mixed with root's. The old directory is renamed with
+// a .migrated suffix rather than deleted. Failures are logged.
+func migrateRootState(dir string) {
+	if _, _, ok := system.SudoUser(); !ok || os.Geteuid() != 0 {
+		return
+	}
+	if defaultDir, err := defaultStateDir(); err != nil || dir != defaultDir {
+		return
+	}
+
+	rootHome, err := os.UserHomeDir()
+	if err != nil {
+		return
+	}
+
+	legacy := filepath.Join(rootHome, ".config", "blast")
+	if legacy == dir {
+		return
+	}
+	if _, err := os.Stat(legacy); err != nil {
+		return
+	}
+
+	// Never mix two CAs or two configs
+	for _, name := range []string{"config.json", "ca"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			log.Printf("Not migrating %s: %s already has a %s", legacy, dir, name)
+			return
+		}
+	}
+
+	if err := copyTree(legacy, dir); err != nil {
+		log.Printf("Failed to migrate %s to %s: %v", legacy, dir, err)
+		return
+	}
+
+	if err := os.Rename(legacy, legacy+".migrated"); err != nil {
+		log.Printf("Migrated %s to %s but failed to set the old copy aside: %v", legacy, dir, err)
+		return
+	}
+
+	log.Printf("Migrated Blast state from %s to %s; the old copy is in %s.migrated", legacy, dir, legacy)
+}
+
+// copyTree copies src into dst, keeping file modes and handing every
+// copied entry to the invoking user. Files that already exist in dst are
+// left alone.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			if err := os.MkdirAll(target, info.Mode().Perm()); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			err := copyFile(path, target, info.Mode().Perm())
+			if errors.Is(err, fs.ErrExist) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unexpected file type: %s", path)
+		}
+
+		return ChownToUser(target)
+	})
+}
+
+// copyFile copies a single regular file. It fails with fs.ErrExist rather
+// than overwrite dst.
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
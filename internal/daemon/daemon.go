@@ -8,24 +8,36 @@ import (
 	"strconv"
 	"syscall"
 	"time"
+
+	"github.com/doganarif/blast/internal/config"
 )
 
 // GetPIDPath returns the path to the daemon PID file
 func GetPIDPath() (string, error) {
-	homeDir, err := os.UserHomeDir()
+	stateDir, err := config.StateDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(homeDir, ".config", "blast", "daemon.pid"), nil
+	return filepath.Join(stateDir, "daemon.pid"), nil
 }
 
 // GetLogPath returns the path to the daemon log file
 func GetLogPath() (string, error) {
-	homeDir, err := os.UserHomeDir()
+	stateDir, err := config.StateDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(stateDir, "daemon.log"), nil
+}
+
+// GetStatusPath returns the path to the file where the daemon publishes
+// upstream health for the CLI
+func GetStatusPath() (string, error) {
+	stateDir, err := config.StateDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(homeDir, ".config", "blast", "daemon.log"), nil
+	return filepath.Join(stateDir, "status.json"), nil
 }
 
 // IsRunning checks if the daemon is currently running
@@ -78,6 +90,9 @@ func Start() error {
 	if err := os.MkdirAll(filepath.Dir(logPath), 0755); err != nil {
 		return fmt.Errorf("failed to create log directory: %w", err)
 	}
+	if err := config.ChownToUser(filepath.Dir(logPath)); err != nil {
+		return fmt.Errorf("failed to set log directory owner: %w", err)
+	}
 
 	// Open log file
 	logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
@@ -85,6 +100,9 @@ func Start() error {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
 	defer logFile.Close()
+	if err := config.ChownToUser(logPath); err != nil {
+		return fmt.Errorf("failed to set log file owner: %w", err)
+	}
 
 	// Start daemon process with platform-specific attributes
 	cmd := exec.Command(exePath, "daemon")
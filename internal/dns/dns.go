@@ -0,0 +1,314 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// DefaultAddr is the loopback address the responder listens on. It
+	// avoids port 53 so it never clashes with a system resolver.
+	DefaultAddr = "127.0.0.1:15353"
+
+	// Short TTLs so route changes show up quickly
+	answerTTL   = 5
+	negativeTTL = 5
+)
+
+// LookupFunc reports whether a name (lower case, no trailing dot) is a
+// configured route
+type LookupFunc func(name string) bool
+
+// Server is a minimal authoritative DNS responder for Blast's zones. It
+// answers A and AAAA queries for configured names with the proxy's
+// addresses and NXDOMAIN for everything else in its zones.
+type Server struct {
+	addr   string
+	lookup LookupFunc
+
+	mu    sync.RWMutex
+	ipv4  net.IP // nil: no A records
+	ipv6  net.IP // nil: no AAAA records
+	zones []string
+
+	udp net.PacketConn
+	tcp net.Listener
+}
+
+// NewServer creates a responder on addr that answers with 127.0.0.1 and ::1
+func NewServer(addr string, lookup LookupFunc) *Server {
+	return &Server{
+		addr:   addr,
+		lookup: lookup,
+		ipv4:   net.IPv4(127, 0, 0, 1),
+		ipv6:   net.IPv6loopback,
+	}
+}
+
+// SetZones sets the TLDs the responder is authoritative for
+func (s *Server) SetZones(zones []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.zones = nil
+	for _, zone := range zones {
+		if !slices.Contains(s.zones, zone) {
+			s.zones = append(s.zones, zone)
+		}
+	}
+}
+
+// zoneOf returns the zone containing name, or "" if it is outside all of
+// them
+func (s *Server) zoneOf(name string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, zone := range s.zones {
+		if name == zone || strings.HasSuffix(name, "."+zone) {
+			return zone
+		}
+	}
+	return ""
+}
+
+// SetAddresses sets the addresses returned for configured names. A nil
+// address suppresses that record type.
+func (s *Server) SetAddresses(ipv4, ipv6 net.IP) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.ipv4 = ipv4
+	s.ipv6 = ipv6
+}
+
+// Start binds the UDP and TCP sockets and serves in the background
+func (s *Server) Start() error {
+	udp, err := net.ListenPacket("udp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	tcp, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		udp.Close()
+		return err
+	}
+
+	s.udp = udp
+	s.tcp = tcp
+
+	go s.serveUDP()
+	go s.serveTCP()
+	return nil
+}
+
+// Stop closes the sockets
+func (s *Server) Stop() error {
+	var errs []error
+	if s.udp != nil {
+		errs = append(errs, s.udp.Close())
+	}
+	if s.tcp != nil {
+		errs = append(errs, s.tcp.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// serveUDP answers datagram queries until the socket is closed
+func (s *Server) serveUDP() {
+	buf := make([]byte, 512)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("DNS UDP listener stopped: %v", err)
+			}
+			return
+		}
+
+		if resp, ok := s.handle(buf[:n]); ok {
+			s.udp.WriteTo(resp, addr)
+		}
+	}
+}
+
+// serveTCP answers length-prefixed queries until the listener is closed
+func (s *Server) serveTCP() {
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				log.Printf("DNS TCP listener stopped: %v", err)
+			}
+			return
+		}
+
+		go s.serveConn(conn)
+	}
+}
+
+// serveConn answers queries on a single TCP connection
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+		var length uint16
+		if err := binary.Read(conn, binary.BigEndian, &length); err != nil {
+			return
+		}
+
+		query := make([]byte, length)
+		if _, err := io.ReadFull(conn, query); err != nil {
+			return
+		}
+
+		resp, ok := s.handle(query)
+		if !ok {
+			return
+		}
+
+		out := binary.BigEndian.AppendUint16(nil, uint16(len(resp)))
+		if _, err := conn.Write(append(out, resp...)); err != nil {
+			return
+		}
+	}
+}
+
+// handle parses a query and builds the response. It reports false for
+// packets that aren't worth answering.
+func (s *Server) handle(query []byte) ([]byte, bool) {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil || header.Response {
+		return nil, false
+	}
+
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return nil, false
+	}
+
+	respHeader := dnsmessage.Header{
+		ID:                 header.ID,
+		Response:           true,
+		OpCode:             header.OpCode,
+		Authoritative:      true,
+		RecursionDesired:   header.RecursionDesired,
+		RecursionAvailable: false,
+	}
+
+	if header.OpCode != 0 || len(questions) != 1 {
+		respHeader.RCode = dnsmessage.RCodeNotImplemented
+		return s.build(respHeader, questions, nil, "")
+	}
+
+	q := questions[0]
+	name := strings.TrimSuffix(strings.ToLower(q.Name.String()), ".")
+	zone := s.zoneOf(name)
+
+	// Configured names are answered wherever they live, so aliases work
+	if s.lookup(name) {
+		answers := s.answers(q)
+		return s.build(respHeader, questions, answers, emptyZone(answers, zone))
+	}
+
+	switch zone {
+	case "":
+		respHeader.RCode = dnsmessage.RCodeRefused
+		respHeader.Authoritative = false
+	case name:
+		// The zone apex exists but has no addresses
+	default:
+		respHeader.RCode = dnsmessage.RCodeNameError
+	}
+	return s.build(respHeader, questions, nil, zone)
+}
+
+// emptyZone returns zone when there are no answers, so the response
+// carries the zone's SOA
+func emptyZone(answers []dnsmessage.Resource, zone string) string {
+	if len(answers) > 0 {
+		return ""
+	}
+	return zone
+}
+
+// answers returns the records for a configured name
+func (s *Server) answers(q dnsmessage.Question) []dnsmessage.Resource {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	header := dnsmessage.ResourceHeader{
+		Name:  q.Name,
+		Class: dnsmessage.ClassINET,
+		TTL:   answerTTL,
+	}
+
+	switch q.Type {
+	case dnsmessage.TypeA:
+		if ip := s.ipv4.To4(); ip != nil {
+			var a dnsmessage.AResource
+			copy(a.A[:], ip)
+			return []dnsmessage.Resource{{Header: header, Body: &a}}
+		}
+	case dnsmessage.TypeAAAA:
+		if ip := s.ipv6.To16(); ip != nil && s.ipv6.To4() == nil {
+			var aaaa dnsmessage.AAAAResource
+			copy(aaaa.AAAA[:], ip)
+			return []dnsmessage.Resource{{Header: header, Body: &aaaa}}
+		}
+	}
+	return nil
+}
+
+// build serialises a response. Negative answers name their zone, whose
+// SOA is included so resolvers cache them briefly.
+func (s *Server) build(header dnsmessage.Header, questions []dnsmessage.Question, answers []dnsmessage.Resource, negativeZone string) ([]byte, bool) {
+	msg := dnsmessage.Message{
+		Header:    header,
+		Questions: questions,
+		Answers:   answers,
+	}
+
+	if negativeZone != "" {
+		msg.Authorities = []dnsmessage.Resource{soa(negativeZone)}
+	}
+
+	resp, err := msg.Pack()
+	if err != nil {
+		return nil, false
+	}
+	return resp, true
+}
+
+// soa returns the start-of-authority record for a zone
+func soa(zone string) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  dnsmessage.MustNewName(zone + "."),
+			Class: dnsmessage.ClassINET,
+			TTL:   negativeTTL,
+		},
+		Body: &dnsmessage.SOAResource{
+			NS:      dnsmessage.MustNewName("ns." + zone + "."),
+			MBox:    dnsmessage.MustNewName("hostmaster." + zone + "."),
+			Serial:  1,
+			Refresh: 3600,
+			Retry:   600,
+			Expire:  86400,
+			MinTTL:  negativeTTL,
+		},
+	}
+}
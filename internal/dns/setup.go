@@ -0,0 +1,36 @@
+package dns
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+)
+
+// ResolvedDropInPath is where the systemd-resolved drop-in is written
+const ResolvedDropInPath = "/etc/systemd/resolved.conf.d/blast.conf"
+
+// splitAddr splits a responder address into its IP and port
+func splitAddr(addr string) (string, string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) == nil {
+		return "", "", fmt.Errorf("invalid DNS address: %s", addr)
+	}
+	return host, port, nil
+}
+
+// ManagedHeader marks files Blast writes and may replace or remove
+const ManagedHeader = "# Managed by blast"
+
+// ResolvedDropIn renders a systemd-resolved drop-in that sends the zones
+// to the responder at addr. Routing-only domains keep every other lookup
+// on the normal servers.
+func ResolvedDropIn(addr string, zones []string) []byte {
+	var domains []string
+	for _, zone := range zones {
+		if !slices.Contains(domains, "~"+zone) {
+			domains = append(domains, "~"+zone)
+		}
+	}
+	return []byte(fmt.Sprintf("%s\n[Resolve]\nDNS=%s\nDomains=%s\n", ManagedHeader, addr, strings.Join(domains, " ")))
+}
@@ -0,0 +1,57 @@
+//go:build darwin
+
+package dns
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const resolverDir = "/etc/resolver"
+
+// Setup writes an /etc/resolver file for each of the given TLDs that sends
+// it to the responder
+func Setup(addr string, zones []string) error {
+	host, port, err := splitAddr(addr)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(resolverDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", resolverDir, err)
+	}
+
+	content := fmt.Sprintf("%s\nnameserver %s\nport %s\n", ManagedHeader, host, port)
+	for _, zone := range zones {
+		path := filepath.Join(resolverDir, zone)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// Teardown removes the /etc/resolver files written by Setup
+func Teardown() error {
+	entries, err := os.ReadDir(resolverDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read %s: %w", resolverDir, err)
+	}
+
+	for _, entry := range entries {
+		path := filepath.Join(resolverDir, entry.Name())
+		content, err := os.ReadFile(path)
+		if err != nil || !bytes.HasPrefix(content, []byte(ManagedHeader)) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+	}
+	return nil
+}
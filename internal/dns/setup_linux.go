@@ -0,0 +1,46 @@
+//go:build linux
+
+package dns
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/doganarif/blast/internal/system"
+)
+
+const resolvedRuntime = "/run/systemd/resolve"
+
+// Setup points systemd-resolved at the responder for the given TLDs
+func Setup(addr string, zones []string) error {
+	if _, _, err := splitAddr(addr); err != nil {
+		return err
+	}
+	if _, err := os.Stat(resolvedRuntime); err != nil {
+		return fmt.Errorf("systemd-resolved is not running; point the Blast domains at %s manually", addr)
+	}
+
+	dir := filepath.Dir(ResolvedDropInPath)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+
+	if err := os.WriteFile(ResolvedDropInPath, ResolvedDropIn(addr, zones), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", ResolvedDropInPath, err)
+	}
+
+	return system.Systemctl("restart", "systemd-resolved")
+}
+
+// Teardown removes the systemd-resolved drop-in
+func Teardown() error {
+	if err := os.Remove(ResolvedDropInPath); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to remove %s: %w", ResolvedDropInPath, err)
+	}
+
+	return system.Systemctl("restart", "systemd-resolved")
+}
@@ -0,0 +1,15 @@
+//go:build !linux && !darwin
+
+package dns
+
+import "fmt"
+
+// Setup is only supported with systemd-resolved or macOS /etc/resolver
+func Setup(addr string, zones []string) error {
+	return fmt.Errorf("blast dns setup is not supported on this platform; point the Blast domains at %s manually", addr)
+}
+
+// Teardown is only supported with systemd-resolved or macOS /etc/resolver
+func Teardown() error {
+	return fmt.Errorf("blast dns teardown is not supported on this platform")
+}
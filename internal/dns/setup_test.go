@@ -0,0 +1,11 @@
+package dns
+
+import "testing"
+
+func TestResolvedDropInZones(t *testing.T) {
+	got := string(ResolvedDropIn("127.0.0.1:15353", []string{"test", "internal", "test"}))
+	want := ManagedHeader + "\n[Resolve]\nDNS=127.0.0.1:15353\nDomains=~test ~internal\n"
+	if got != want {
+		t.Errorf("drop-in:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,98 @@
+package hosts
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/doganarif/blast/internal/config"
+	"github.com/doganarif/blast/internal/dns"
+	"github.com/doganarif/blast/internal/system"
+)
+
+// Backend makes Blast domains resolve to the local proxy
+type Backend interface {
+	Add(domain string) error
+	Remove(domain string) error
+}
+
+// Default locations of the files each backend manages
+const (
+	dnsmasqPath        = "/etc/dnsmasq.d/blast.conf"
+	networkManagerPath = "/etc/NetworkManager/dnsmasq.d/blast.conf"
+)
+
+// New returns the named backend (see the config.Resolver* constants).
+// Every system path is placed under root, so tests can point a backend at
+// a temporary directory; services are only reloaded when root is "".
+// dnsAddr is the built-in DNS responder, which the resolved backend
+// routes the zones to.
+func New(name, root, dnsAddr string, zones []string) (Backend, error) {
+	path := func(p string) string {
+		if root == "" {
+			return p
+		}
+		return filepath.Join(root, p)
+	}
+	reload := func(args ...string) func() error {
+		if root != "" {
+			return nil
+		}
+		return func() error { return system.Systemctl(args...) }
+	}
+
+	switch name {
+	case config.ResolverHosts:
+		return HostsFile{Path: path(GetHostsPath())}, nil
+	case config.ResolverDnsmasq:
+		return Dnsmasq{Path: path(dnsmasqPath), Reload: reload("restart", "dnsmasq")}, nil
+	case config.ResolverNetworkManager:
+		return Dnsmasq{Path: path(networkManagerPath), Reload: reload("reload", "NetworkManager")}, nil
+	case config.ResolverResolved:
+		if dnsAddr == "" {
+			return nil, fmt.Errorf("the resolved backend needs the built-in DNS server; set dns_addr first")
+		}
+		return Resolved{Path: path(dns.ResolvedDropInPath), DNSAddr: dnsAddr, Zones: zones, Reload: reload("restart", "systemd-resolved")}, nil
+	case config.ResolverNone:
+		return none{}, nil
+	default:
+		return nil, fmt.Errorf("unknown resolver backend: %s", name)
+	}
+}
+
+// FromConfig returns the backend selected in the config, acting on the
+// real system files
+func FromConfig(cfg *config.Config) (Backend, error) {
+	return New(cfg.GetResolver(), "", cfg.GetDNSAddr(), cfg.Zones())
+}
+
+// Migrate moves the entries of renamed routes to their new names. The
+// hosts file and dnsmasq drop-in are rewritten once for all renames, so a
+// migration takes a single backup and reload. Other backends get a Remove
+// and Add per rename, and a failed rename doesn't stop the others.
+func Migrate(b Backend, renames []config.Rename) error {
+	switch b := b.(type) {
+	case HostsFile:
+		return b.rename(renames)
+	case Dnsmasq:
+		return b.rename(renames)
+	}
+
+	var errs []error
+	for _, rename := range renames {
+		if err := b.Remove(rename.Old); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := b.Add(rename.New); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// none leaves name resolution to something outside Blast
+type none struct{}
+
+func (none) Add(domain string) error    { return nil }
+func (none) Remove(domain string) error { return nil }
@@ -0,0 +1,262 @@
+package hosts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/doganarif/blast/internal/config"
+	"github.com/doganarif/blast/internal/dns"
+)
+
+// newTestBackend returns the named backend rooted in a temporary directory
+// and the path of the file it manages there
+func newTestBackend(t *testing.T, name string) (Backend, string) {
+	t.Helper()
+
+	root := t.TempDir()
+	b, err := New(name, root, dns.DefaultAddr, []string{"test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var path string
+	switch b := b.(type) {
+	case HostsFile:
+		path = b.Path
+	case Dnsmasq:
+		path = b.Path
+		if b.Reload != nil {
+			t.Fatal("reload set for a rooted backend")
+		}
+	case Resolved:
+		path = b.Path
+		if b.Reload != nil {
+			t.Fatal("reload set for a rooted backend")
+		}
+	default:
+		t.Fatalf("unexpected backend %T", b)
+	}
+
+	if !strings.HasPrefix(path, root) {
+		t.Fatalf("%s is outside the root %s", path, root)
+	}
+	return b, path
+}
+
+// readFile returns a file's content, or "" if it doesn't exist
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ""
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestHostsFileBackend(t *testing.T) {
+	b, path := newTestBackend(t, config.ResolverHosts)
+
+	const original = "127.0.0.1 localhost\n"
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Add("app.blast"); err != nil {
+		t.Fatal(err)
+	}
+	added := readFile(t, path)
+	if !strings.HasPrefix(added, original) || !strings.Contains(added, "127.0.0.1 app.blast\n") {
+		t.Fatalf("unexpected hosts file after Add:\n%s", added)
+	}
+
+	// Adding again changes nothing and takes no new backup
+	if err := b.Add("app.blast"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != added {
+		t.Errorf("second Add changed the file:\n%s", got)
+	}
+	if _, err := os.Stat(path + ".blast-backup.2"); !os.IsNotExist(err) {
+		t.Errorf("second Add took a backup")
+	}
+
+	if err := b.Add("*.app.blast"); err == nil {
+		t.Errorf("Add accepted a wildcard")
+	}
+
+	// Removing the last entry drops the managed block
+	if err := b.Remove("app.blast"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != original {
+		t.Errorf("hosts file after Remove:\n%s\nwant:\n%s", got, original)
+	}
+	if err := b.Remove("app.blast"); err != nil {
+		t.Errorf("second Remove: %v", err)
+	}
+}
+
+func TestDnsmasqBackend(t *testing.T) {
+	for _, name := range []string{config.ResolverDnsmasq, config.ResolverNetworkManager} {
+		t.Run(name, func(t *testing.T) {
+			b, path := newTestBackend(t, name)
+
+			for _, domain := range []string{"app.blast", "app.blast", "*.api.blast"} {
+				if err := b.Add(domain); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want := dns.ManagedHeader + "\n" +
+				"# route app.blast\n" +
+				"# route *.api.blast\n" +
+				"address=/app.blast/127.0.0.1\n" +
+				"address=/app.blast/::1\n" +
+				"address=/api.blast/127.0.0.1\n" +
+				"address=/api.blast/::1\n"
+			if got := readFile(t, path); got != want {
+				t.Errorf("drop-in:\n%s\nwant:\n%s", got, want)
+			}
+
+			// The drop-in is deleted with its last entry
+			for _, domain := range []string{"app.blast", "*.api.blast", "app.blast"} {
+				if err := b.Remove(domain); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("drop-in left behind: %v", err)
+			}
+		})
+	}
+}
+
+func TestDnsmasqSharedLines(t *testing.T) {
+	b, path := newTestBackend(t, config.ResolverDnsmasq)
+
+	for _, domain := range []string{"app.blast", "*.app.blast"} {
+		if err := b.Add(domain); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The wildcard's lines are the plain route's, which is still there
+	if err := b.Remove("*.app.blast"); err != nil {
+		t.Fatal(err)
+	}
+	want := dns.ManagedHeader + "\n" +
+		"# route app.blast\n" +
+		"address=/app.blast/127.0.0.1\n" +
+		"address=/app.blast/::1\n"
+	if got := readFile(t, path); got != want {
+		t.Errorf("drop-in:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestDnsmasqLegacyDropIn(t *testing.T) {
+	b, path := newTestBackend(t, config.ResolverDnsmasq)
+
+	legacy := dns.ManagedHeader + "\n" +
+		"address=/app.blast/127.0.0.1\n" +
+		"address=/app.blast/::1\n"
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.Remove("app.blast"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("drop-in left behind: %v", err)
+	}
+}
+
+func TestResolvedBackend(t *testing.T) {
+	b, path := newTestBackend(t, config.ResolverResolved)
+
+	for _, domain := range []string{"app.blast", "api.test"} {
+		if err := b.Add(domain); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := string(dns.ResolvedDropIn(dns.DefaultAddr, []string{"test"}))
+	if got := readFile(t, path); got != want {
+		t.Errorf("drop-in:\n%s\nwant:\n%s", got, want)
+	}
+
+	// The responder stops answering for removed routes on its own
+	if err := b.Remove("app.blast"); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != want {
+		t.Errorf("Remove changed the drop-in:\n%s", got)
+	}
+}
+
+func TestResolvedBackendNeedsDNS(t *testing.T) {
+	if _, err := New(config.ResolverResolved, t.TempDir(), "", nil); err == nil {
+		t.Error("expected an error without a DNS address")
+	}
+}
+
+func TestMigrateSkipsWildcardsInHostsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	content := "127.0.0.1 localhost\n" + beginMarker + "\n127.0.0.1 app.blast\n::1 app.blast\n" + endMarker + "\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := Migrate(HostsFile{Path: path}, []config.Rename{
+		{Old: "*.api.blast", New: "*.api.test"},
+		{Old: "app.blast", New: "app.test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "127.0.0.1 localhost\n" + beginMarker + "\n127.0.0.1 app.test\n::1 app.test\n" + endMarker + "\n"
+	if got := readFile(t, path); got != want {
+		t.Errorf("hosts file:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestMigrateTakesOneBackup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	content := "127.0.0.1 localhost\n" + beginMarker + "\n" +
+		"127.0.0.1 a.blast\n::1 a.blast\n" +
+		"127.0.0.1 b.blast\n::1 b.blast\n" +
+		"127.0.0.1 c.blast\n::1 c.blast\n" +
+		"127.0.0.1 d.blast\n::1 d.blast\n" +
+		endMarker + "\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var renames []config.Rename
+	for _, name := range []string{"a", "b", "c", "d"} {
+		renames = append(renames, config.Rename{Old: name + ".blast", New: name + ".test"})
+	}
+	if err := Migrate(HostsFile{Path: path}, renames); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := readFile(t, path+".blast-backup.1"); got != content {
+		t.Errorf("newest backup:\n%s\nwant the pre-migration file:\n%s", got, content)
+	}
+	if _, err := os.Stat(path + ".blast-backup.2"); !os.IsNotExist(err) {
+		t.Errorf("migration took more than one backup")
+	}
+}
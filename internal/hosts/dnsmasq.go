@@ -0,0 +1,156 @@
+package hosts
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/doganarif/blast/internal/config"
+	"github.com/doganarif/blast/internal/dns"
+)
+
+// routePrefix marks the comment lines listing the routes a drop-in serves.
+// A route and its wildcard share address lines, so the lines are rebuilt
+// from this list rather than edited in place.
+const routePrefix = "# route "
+
+// Dnsmasq is the Backend that writes address=/domain/127.0.0.1 and ::1
+// lines to a dnsmasq config drop-in. It serves both a standalone dnsmasq
+// and the one NetworkManager runs.
+type Dnsmasq struct {
+	Path   string
+	Reload func() error // makes dnsmasq reread its config; nil: skip
+}
+
+// Add adds the address lines for domain
+func (d Dnsmasq) Add(domain string) error {
+	routes, err := d.read()
+	if err != nil {
+		return err
+	}
+
+	if slices.Contains(routes, domain) {
+		return nil
+	}
+	return d.write(append(routes, domain))
+}
+
+// Remove removes domain and drops its address lines unless another route
+// still needs them. The drop-in is deleted once it holds no entries.
+func (d Dnsmasq) Remove(domain string) error {
+	routes, err := d.read()
+	if err != nil {
+		return err
+	}
+
+	kept := slices.DeleteFunc(slices.Clone(routes), func(r string) bool {
+		return r == domain
+	})
+
+	if len(kept) == len(routes) {
+		return nil
+	}
+	return d.write(kept)
+}
+
+// rename moves routes to their new names with a single write and reload
+func (d Dnsmasq) rename(renames []config.Rename) error {
+	routes, err := d.read()
+	if err != nil {
+		return err
+	}
+
+	kept := slices.DeleteFunc(slices.Clone(routes), func(r string) bool {
+		return slices.ContainsFunc(renames, func(rename config.Rename) bool { return rename.Old == r })
+	})
+	for _, rename := range renames {
+		if !slices.Contains(kept, rename.New) {
+			kept = append(kept, rename.New)
+		}
+	}
+
+	if slices.Equal(kept, routes) {
+		return nil
+	}
+	return d.write(kept)
+}
+
+// read returns the routes in the drop-in. Drop-ins written before routes
+// were listed get one route per addressed domain.
+func (d Dnsmasq) read() ([]string, error) {
+	content, err := os.ReadFile(d.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dnsmasq config: %w", err)
+	}
+
+	var routes, addressed []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if route, ok := strings.CutPrefix(line, routePrefix); ok {
+			routes = append(routes, route)
+		} else if rest, ok := strings.CutPrefix(line, "address=/"); ok {
+			if domain, _, ok := strings.Cut(rest, "/"); ok && !slices.Contains(addressed, domain) {
+				addressed = append(addressed, domain)
+			}
+		}
+	}
+
+	if routes == nil {
+		return addressed, nil
+	}
+	return routes, nil
+}
+
+// write replaces the drop-in with the entries for routes and reloads
+// dnsmasq
+func (d Dnsmasq) write(routes []string) error {
+	if len(routes) == 0 {
+		if err := os.Remove(d.Path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove dnsmasq config: %w", err)
+		}
+	} else {
+		if err := os.MkdirAll(filepath.Dir(d.Path), 0755); err != nil {
+			return fmt.Errorf("failed to create dnsmasq config directory: %w", err)
+		}
+
+		var b strings.Builder
+		b.WriteString(dns.ManagedHeader + "\n")
+		for _, route := range routes {
+			b.WriteString(routePrefix + route + "\n")
+		}
+
+		var lines []string
+		for _, route := range routes {
+			for _, line := range dnsmasqLines(route) {
+				if !slices.Contains(lines, line) {
+					lines = append(lines, line)
+				}
+			}
+		}
+		b.WriteString(strings.Join(lines, "\n") + "\n")
+
+		if err := os.WriteFile(d.Path, []byte(b.String()), 0644); err != nil {
+			return fmt.Errorf("failed to write dnsmasq config: %w", err)
+		}
+	}
+
+	if d.Reload != nil {
+		return d.Reload()
+	}
+	return nil
+}
+
+// dnsmasqLines returns the address lines for domain. dnsmasq matches
+// subdomains too, so a wildcard route becomes its parent domain.
+func dnsmasqLines(domain string) []string {
+	domain = strings.TrimPrefix(domain, "*.")
+	return []string{
+		"address=/" + domain + "/127.0.0.1",
+		"address=/" + domain + "/::1",
+	}
+}
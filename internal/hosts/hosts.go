@@ -1,15 +1,30 @@
 package hosts
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"os"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
+
+	"github.com/doganarif/blast/internal/config"
+)
+
+// Blast's entries live between these lines; everything else in the file
+// is left untouched
+const (
+	beginMarker = "# BEGIN blast"
+	endMarker   = "# END blast"
 )
 
-const marker = "# blast-proxy"
+// legacyMarker tagged single entries written by older versions. They are
+// moved into the managed block on the next write.
+const legacyMarker = "blast-proxy"
+
+// backupCount is how many previous versions of the hosts file are kept
+const backupCount = 3
 
 // GetHostsPath returns the platform-specific hosts file path
 func GetHostsPath() string {
@@ -19,73 +34,272 @@ func GetHostsPath() string {
 	return "/etc/hosts"
 }
 
-// AddEntry adds a domain entry to the hosts file
+// HostsFile is the Backend that writes entries to a managed block in a
+// hosts file
+type HostsFile struct {
+	Path string
+}
+
+// AddEntry adds a domain entry to the system hosts file
 func AddEntry(domain string) error {
-	hostsPath := GetHostsPath()
+	return HostsFile{Path: GetHostsPath()}.Add(domain)
+}
+
+// RemoveEntry removes a domain entry from the system hosts file
+func RemoveEntry(domain string) error {
+	return HostsFile{Path: GetHostsPath()}.Remove(domain)
+}
+
+// Repair rewrites the managed block of the system hosts file to hold
+// exactly the configured proxies and their aliases plus any extra
+// domains, such as the dashboard
+func Repair(cfg *config.Config, extra ...string) error {
+	var domains []string
+	for _, mapping := range cfg.ListProxies() {
+		domains = append(domains, mapping.Hostnames()...)
+	}
+	return HostsFile{Path: GetHostsPath()}.Sync(append(domains, extra...))
+}
+
+// Add adds a domain entry to the hosts file. Hosts files can't express
+// wildcard routes; those need the DNS server or dnsmasq.
+func (h HostsFile) Add(domain string) error {
+	if config.IsWildcard(domain) {
+		return fmt.Errorf("the hosts file can't resolve %s; use the dnsmasq or resolved backend", domain)
+	}
 
-	// Read current content
-	content, err := os.ReadFile(hostsPath)
+	f, err := h.read()
 	if err != nil {
-		return fmt.Errorf("failed to read hosts file: %w", err)
+		return err
 	}
 
-	// Check if entry already exists
-	scanner := bufio.NewScanner(bytes.NewReader(content))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, domain) && strings.Contains(line, marker) {
-			// Entry already exists
-			return nil
-		}
+	f.addDomains([]string{domain})
+	return h.write(f)
+}
+
+// Remove removes a domain entry from the hosts file. Only entries naming
+// exactly this domain are affected.
+func (h HostsFile) Remove(domain string) error {
+	f, err := h.read()
+	if err != nil {
+		return err
 	}
 
-	// Append new entry
-	entry := fmt.Sprintf("127.0.0.1 %s %s\n", domain, marker)
-	newContent := append(content, []byte(entry)...)
+	f.domains = slices.DeleteFunc(f.domains, func(d string) bool { return d == domain })
+	return h.write(f)
+}
 
-	// Write back
-	if err := os.WriteFile(hostsPath, newContent, 0644); err != nil {
-		return fmt.Errorf("failed to write hosts file: %w", err)
+// Sync replaces the managed block with entries for exactly these domains.
+// Wildcard domains are skipped.
+func (h HostsFile) Sync(domains []string) error {
+	f, err := h.read()
+	if err != nil {
+		return err
 	}
 
-	return nil
+	f.domains = nil
+	f.addDomains(slices.DeleteFunc(slices.Clone(domains), config.IsWildcard))
+	return h.write(f)
 }
 
-// RemoveEntry removes a domain entry from the hosts file
-func RemoveEntry(domain string) error {
-	hostsPath := GetHostsPath()
+// rename moves entries to their new names in a single write. Wildcard
+// routes are skipped, since the hosts file can't express them.
+func (h HostsFile) rename(renames []config.Rename) error {
+	f, err := h.read()
+	if err != nil {
+		return err
+	}
+
+	for _, rename := range renames {
+		f.domains = slices.DeleteFunc(f.domains, func(d string) bool { return d == rename.Old })
+	}
+	for _, rename := range renames {
+		if !config.IsWildcard(rename.New) {
+			f.addDomains([]string{rename.New})
+		}
+	}
+	return h.write(f)
+}
+
+// hostsFile is a parsed hosts file: the lines outside the managed block,
+// kept verbatim, and the domains inside it
+type hostsFile struct {
+	before   []string
+	after    []string
+	domains  []string
+	newline  string // "\r\n" for files using Windows line endings
+	original []byte
+}
 
-	// Read current content
-	content, err := os.ReadFile(hostsPath)
+// read parses the hosts file
+func (h HostsFile) read() (*hostsFile, error) {
+	content, err := os.ReadFile(h.Path)
 	if err != nil {
-		return fmt.Errorf("failed to read hosts file: %w", err)
+		return nil, fmt.Errorf("failed to read hosts file: %w", err)
 	}
+	f := parse(string(content))
+	f.original = content
+	return f, nil
+}
+
+// parse splits a hosts file into the managed block and the lines around
+// it. An unterminated block runs to the end of the file. A file with
+// Windows line endings is written back with them.
+func parse(content string) *hostsFile {
+	f := &hostsFile{newline: "\n"}
+	if content == "" {
+		return f
+	}
+	if strings.Contains(content, "\r\n") {
+		f.newline = "\r\n"
+	}
+
+	inBlock, seenBlock := false, false
+	for _, line := range strings.Split(strings.TrimSuffix(content, "\n"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		trimmed := strings.TrimSpace(line)
 
-	// Filter out the entry
-	var newLines []string
-	scanner := bufio.NewScanner(bytes.NewReader(content))
-	found := false
+		switch {
+		case !seenBlock && trimmed == beginMarker:
+			inBlock, seenBlock = true, true
+		case inBlock && trimmed == endMarker:
+			inBlock = false
+		case inBlock:
+			f.addDomains(parseLine(line))
+		case isLegacyEntry(line):
+			f.addDomains(parseLine(line))
+		case !seenBlock:
+			f.before = append(f.before, line)
+		default:
+			f.after = append(f.after, line)
+		}
+	}
+	return f
+}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		// Skip lines that contain both the domain and our marker
-		if strings.Contains(line, domain) && strings.Contains(line, marker) {
-			found = true
-			continue
+// addDomains records domains for the managed block, skipping duplicates
+func (f *hostsFile) addDomains(names []string) {
+	for _, name := range names {
+		if !slices.Contains(f.domains, name) {
+			f.domains = append(f.domains, name)
 		}
-		newLines = append(newLines, line)
 	}
+}
+
+// render formats the file with the managed block in place. Each domain
+// gets an IPv4 and an IPv6 loopback entry. A file without a block gets
+// one appended at the end; an empty block is dropped.
+func (f *hostsFile) render() []byte {
+	var lines []string
+	lines = append(lines, f.before...)
 
-	if !found {
-		// Entry doesn't exist, nothing to do
+	if len(f.domains) > 0 {
+		lines = append(lines, beginMarker)
+		for _, domain := range f.domains {
+			lines = append(lines, "127.0.0.1 "+domain, "::1 "+domain)
+		}
+		lines = append(lines, endMarker)
+	}
+
+	lines = append(lines, f.after...)
+	if len(lines) == 0 {
 		return nil
 	}
+	return []byte(strings.Join(lines, f.newline) + f.newline)
+}
+
+// parseLine returns the hostnames of a hosts file entry, without the
+// address and any comment
+func parseLine(line string) []string {
+	if i := strings.IndexByte(line, '#'); i >= 0 {
+		line = line[:i]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil
+	}
+	return fields[1:]
+}
+
+// isLegacyEntry reports whether a line is an entry written by an older
+// version, tagged with a trailing "# blast-proxy" comment
+func isLegacyEntry(line string) bool {
+	i := strings.IndexByte(line, '#')
+	if i < 0 {
+		return false
+	}
+	return strings.TrimSpace(line[i+1:]) == legacyMarker && len(parseLine(line)) > 0
+}
+
+// write backs up the current file and replaces it atomically. Nothing is
+// written when the content is unchanged. A symlinked hosts file has its
+// target replaced, so the link survives.
+func (h HostsFile) write(f *hostsFile) error {
+	content := f.render()
+	if bytes.Equal(content, f.original) {
+		return nil
+	}
+
+	path, err := filepath.EvalSymlinks(h.Path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve hosts file: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat hosts file: %w", err)
+	}
+
+	if err := h.backup(); err != nil {
+		return fmt.Errorf("failed to back up hosts file: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".hosts-blast-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary hosts file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
 
-	// Write back
-	newContent := strings.Join(newLines, "\n") + "\n"
-	if err := os.WriteFile(hostsPath, []byte(newContent), 0644); err != nil {
+	_, err = tmp.Write(content)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), info.Mode().Perm())
+	}
+	if err != nil {
 		return fmt.Errorf("failed to write hosts file: %w", err)
 	}
 
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		// A bind-mounted hosts file (as in containers) can't be replaced
+		if err := os.WriteFile(path, content, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to write hosts file: %w", err)
+		}
+	}
 	return nil
 }
+
+// backup rotates the backups next to the hosts file and saves the current
+// version as the newest one
+func (h HostsFile) backup() error {
+	name := func(n int) string {
+		return fmt.Sprintf("%s.blast-backup.%d", h.Path, n)
+	}
+
+	for n := backupCount - 1; n >= 1; n-- {
+		if err := os.Rename(name(n), name(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	content, err := os.ReadFile(h.Path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name(1), content, 0644)
+}
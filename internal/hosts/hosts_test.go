@@ -0,0 +1,78 @@
+package hosts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHostsFileBothStacks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := HostsFile{Path: path}
+	if err := h.Sync([]string{"app.blast", "*.api.blast", "blast.blast"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "127.0.0.1 localhost\n" +
+		beginMarker + "\n" +
+		"127.0.0.1 app.blast\n" +
+		"::1 app.blast\n" +
+		"127.0.0.1 blast.blast\n" +
+		"::1 blast.blast\n" +
+		endMarker + "\n"
+	if got := readFile(t, path); got != want {
+		t.Errorf("hosts file:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestHostsFileKeepsSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "hosts.real")
+	if err := os.WriteFile(target, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "hosts")
+	if err := os.Symlink(target, link); err != nil {
+		t.Skip("symlinks unavailable:", err)
+	}
+
+	if err := (HostsFile{Path: link}).Add("app.blast"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Lstat(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		t.Fatal("the symlink was replaced by a regular file")
+	}
+	if got := readFile(t, target); !strings.Contains(got, "127.0.0.1 app.blast\n") {
+		t.Errorf("link target:\n%s", got)
+	}
+}
+
+func TestHostsFileKeepsCRLF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(path, []byte("# comment\r\n127.0.0.1 localhost\r\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := (HostsFile{Path: path}).Add("app.blast"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "# comment\r\n127.0.0.1 localhost\r\n" +
+		beginMarker + "\r\n" +
+		"127.0.0.1 app.blast\r\n" +
+		"::1 app.blast\r\n" +
+		endMarker + "\r\n"
+	if got := readFile(t, path); got != want {
+		t.Errorf("hosts file:\n%q\nwant:\n%q", got, want)
+	}
+}
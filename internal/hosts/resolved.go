@@ -0,0 +1,51 @@
+package hosts
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/doganarif/blast/internal/dns"
+)
+
+// Resolved is the Backend that routes Blast's zones to its DNS responder
+// through a systemd-resolved drop-in. The responder answers for
+// configured routes only, so individual domains need no entries.
+type Resolved struct {
+	Path    string
+	DNSAddr string
+	Zones   []string     // TLDs to route to the responder
+	Reload  func() error // restarts systemd-resolved; nil: skip
+}
+
+// Add makes sure the drop-in is in place
+func (r Resolved) Add(domain string) error {
+	want := dns.ResolvedDropIn(r.DNSAddr, r.Zones)
+
+	content, err := os.ReadFile(r.Path)
+	if err == nil && bytes.Equal(content, want) {
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read resolved drop-in: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(r.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create resolved drop-in directory: %w", err)
+	}
+	if err := os.WriteFile(r.Path, want, 0644); err != nil {
+		return fmt.Errorf("failed to write resolved drop-in: %w", err)
+	}
+
+	if r.Reload != nil {
+		return r.Reload()
+	}
+	return nil
+}
+
+// Remove is a no-op: once the route is gone the responder stops answering
+// for it
+func (r Resolved) Remove(domain string) error {
+	return nil
+}
@@ -0,0 +1,115 @@
+package inspect
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+)
+
+// bodyBuffer keeps the first MaxBodySize bytes written to it and counts
+// the rest. It is written by the transport and read when the exchange
+// finishes, which may happen on different goroutines.
+type bodyBuffer struct {
+	mu   sync.Mutex
+	buf  bytes.Buffer
+	size int64
+	eof  bool // the whole body went through
+}
+
+// Write implements io.Writer and never fails
+func (b *bodyBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.size += int64(len(p))
+	if room := MaxBodySize - b.buf.Len(); room > 0 {
+		b.buf.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+// finish records that the body was read to the end
+func (b *bodyBuffer) finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.eof = true
+}
+
+// finished reports whether the body was read to the end
+func (b *bodyBuffer) finished() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.eof
+}
+
+// snapshot returns a copy of the kept bytes, the total size and whether
+// the body was truncated
+func (b *bodyBuffer) snapshot() ([]byte, int64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.buf.Len() == 0 {
+		return nil, b.size, false
+	}
+	return bytes.Clone(b.buf.Bytes()), b.size, b.size > int64(b.buf.Len())
+}
+
+// teeBody copies a request body into a bodyBuffer as it is read
+type teeBody struct {
+	io.ReadCloser
+	buf *bodyBuffer
+}
+
+// Read implements io.Reader
+func (t *teeBody) Read(p []byte) (int, error) {
+	n, err := t.ReadCloser.Read(p)
+	if n > 0 {
+		t.buf.Write(p[:n])
+	}
+	if err == io.EOF {
+		t.buf.finish()
+	}
+	return n, err
+}
+
+// Recorder wraps a ResponseWriter and captures the status, headers and a
+// bounded copy of the body. It exposes the underlying writer through
+// Unwrap so flushing and connection upgrades keep working.
+type Recorder struct {
+	http.ResponseWriter
+	status int
+	header http.Header
+	body   bodyBuffer
+}
+
+// NewRecorder wraps w for capture
+func NewRecorder(w http.ResponseWriter) *Recorder {
+	return &Recorder{ResponseWriter: w}
+}
+
+// WriteHeader records the status and headers before sending them
+func (rec *Recorder) WriteHeader(code int) {
+	// Informational responses are forwarded but not recorded
+	if rec.status == 0 && (code >= 200 || code == http.StatusSwitchingProtocols) {
+		rec.status = code
+		rec.header = rec.Header().Clone()
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+// Write records the body before sending it
+func (rec *Recorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(p)
+	return rec.ResponseWriter.Write(p)
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (rec *Recorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,276 @@
+package inspect
+
+import (
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// HAR is an HTTP Archive 1.2 document
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root of a HAR document
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator names the application that produced the archive
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a single request/response pair
+type HAREntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+// HARRequest describes the request sent by the client
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARResponse describes the response returned to the client
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARCookie    `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARNameValue is a header or query string parameter
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARCookie is a request or response cookie
+type HARCookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+// HARPostData is the request body
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARContent is the response body
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings are phase durations in milliseconds, -1 when not applicable
+type HARTimings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+// NewHAR builds an HTTP Archive from captured exchanges. Exchanges are
+// given newest first, as returned by Store.List, and archived oldest first.
+func NewHAR(exchanges []*Exchange) *HAR {
+	h := &HAR{
+		Log: HARLog{
+			Version: "1.2",
+			Creator: HARCreator{Name: "Blast", Version: buildVersion()},
+			Entries: make([]HAREntry, 0, len(exchanges)),
+		},
+	}
+
+	for i := len(exchanges) - 1; i >= 0; i-- {
+		h.Log.Entries = append(h.Log.Entries, harEntry(exchanges[i]))
+	}
+	return h
+}
+
+// harEntry converts a single exchange
+func harEntry(ex *Exchange) HAREntry {
+	timings := HARTimings{
+		Blocked: millis(ex.Timings.Blocked),
+		DNS:     millis(ex.Timings.DNS),
+		Connect: millis(ex.Timings.Connect),
+		Send:    millis(ex.Timings.Send),
+		Wait:    millis(ex.Timings.Wait),
+		Receive: millis(ex.Timings.Receive),
+		SSL:     millis(ex.Timings.TLS),
+	}
+
+	// HAR requires send, wait and receive to be non-negative
+	timings.Send = max(timings.Send, 0)
+	timings.Wait = max(timings.Wait, 0)
+	timings.Receive = max(timings.Receive, 0)
+
+	return HAREntry{
+		StartedDateTime: ex.Started.Format(time.RFC3339Nano),
+		Time:            millis(ex.Duration),
+		Request:         harRequest(ex),
+		Response:        harResponse(ex),
+		Timings:         timings,
+		Comment:         ex.Error,
+	}
+}
+
+// harRequest converts the request side of an exchange
+func harRequest(ex *Exchange) HARRequest {
+	req := HARRequest{
+		Method:      ex.Method,
+		URL:         ex.URL,
+		HTTPVersion: ex.Proto,
+		Cookies:     []HARCookie{},
+		Headers:     harHeaders(ex.RequestHeader),
+		QueryString: []HARNameValue{},
+		HeadersSize: -1,
+		BodySize:    ex.RequestSize,
+	}
+
+	if u, err := url.Parse(ex.URL); err == nil {
+		for name, values := range u.Query() {
+			for _, v := range values {
+				req.QueryString = append(req.QueryString, HARNameValue{Name: name, Value: v})
+			}
+		}
+	}
+
+	header := ex.RequestHeader
+	for _, c := range (&http.Request{Header: header}).Cookies() {
+		req.Cookies = append(req.Cookies, HARCookie{Name: c.Name, Value: c.Value})
+	}
+
+	if len(ex.RequestBody) > 0 {
+		req.PostData = &HARPostData{
+			MimeType: header.Get("Content-Type"),
+			Text:     string(ex.RequestBody),
+		}
+	}
+	return req
+}
+
+// harResponse converts the response side of an exchange
+func harResponse(ex *Exchange) HARResponse {
+	header := ex.ResponseHeader
+	resp := HARResponse{
+		Status:      ex.Status,
+		StatusText:  http.StatusText(ex.Status),
+		HTTPVersion: ex.Proto,
+		Cookies:     []HARCookie{},
+		Headers:     harHeaders(header),
+		RedirectURL: header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    ex.ResponseSize,
+		Content: HARContent{
+			Size:     ex.ResponseSize,
+			MimeType: header.Get("Content-Type"),
+		},
+	}
+
+	for _, c := range (&http.Response{Header: header}).Cookies() {
+		cookie := HARCookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		}
+		if !c.Expires.IsZero() {
+			cookie.Expires = c.Expires.Format(time.RFC3339)
+		}
+		resp.Cookies = append(resp.Cookies, cookie)
+	}
+
+	if len(ex.ResponseBody) > 0 {
+		body := ex.ResponseBody
+		if isText(header.Get("Content-Type")) && utf8.Valid(body) && header.Get("Content-Encoding") == "" {
+			resp.Content.Text = string(body)
+		} else {
+			resp.Content.Text = base64.StdEncoding.EncodeToString(body)
+			resp.Content.Encoding = "base64"
+		}
+		if ex.ResponseBodyTruncated {
+			resp.Content.Comment = "body truncated by Blast"
+		}
+	}
+	return resp
+}
+
+// harHeaders flattens a header map into HAR name/value pairs
+func harHeaders(header http.Header) []HARNameValue {
+	pairs := []HARNameValue{}
+	for name, values := range header {
+		for _, v := range values {
+			pairs = append(pairs, HARNameValue{Name: name, Value: v})
+		}
+	}
+	return pairs
+}
+
+// isText reports whether a content type is safe to embed as text
+func isText(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "json") ||
+		strings.HasSuffix(mediaType, "xml") ||
+		strings.HasSuffix(mediaType, "javascript")
+}
+
+// buildVersion returns the module version of the running binary
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
+
+// millis converts a duration to fractional milliseconds, keeping -1
+func millis(d time.Duration) float64 {
+	if d < 0 {
+		return -1
+	}
+	return float64(d) / float64(time.Millisecond)
+}
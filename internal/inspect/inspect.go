@@ -0,0 +1,304 @@
+package inspect
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCapacity is the number of exchanges kept per route
+	DefaultCapacity = 200
+
+	// MaxBodySize is the number of body bytes kept per request or response
+	MaxBodySize = 64 * 1024
+)
+
+// Exchange is a captured request/response pair
+type Exchange struct {
+	ID         uint64        `json:"id"`
+	Route      string        `json:"route"`
+	Upstream   string        `json:"upstream"`
+	ClientAddr string        `json:"client_addr"`
+	Started    time.Time     `json:"started"`
+	Duration   time.Duration `json:"duration"`
+	Error      string        `json:"error,omitempty"`
+	Timings    Timings       `json:"timings"`
+	ReplayOf   uint64        `json:"replay_of,omitempty"`
+
+	Method               string      `json:"method"`
+	URL                  string      `json:"url"`
+	Proto                string      `json:"proto"`
+	RequestHeader        http.Header `json:"request_header"`
+	RequestBody          []byte      `json:"request_body,omitempty"`
+	RequestSize          int64       `json:"request_size"`
+	RequestBodyTruncated bool        `json:"request_body_truncated,omitempty"`
+	RequestBodyUnread    bool        `json:"request_body_unread,omitempty"` // the upstream stopped before the end
+
+	Status                int         `json:"status"`
+	ResponseHeader        http.Header `json:"response_header"`
+	ResponseBody          []byte      `json:"response_body,omitempty"`
+	ResponseSize          int64       `json:"response_size"`
+	ResponseBodyTruncated bool        `json:"response_body_truncated,omitempty"`
+
+	requestBody   *bodyBuffer
+	requestLength int64 // Content-Length, or -1 when unknown
+	tracer        *tracer
+}
+
+// Filter selects exchanges by route, method and status. Empty fields match
+// everything. Status is an exact code ("404") or a class ("5xx").
+type Filter struct {
+	Route  string
+	Method string
+	Status string
+}
+
+// Match reports whether the exchange passes the filter
+func (f Filter) Match(ex *Exchange) bool {
+	if f.Route != "" && ex.Route != f.Route {
+		return false
+	}
+	if f.Method != "" && !strings.EqualFold(ex.Method, f.Method) {
+		return false
+	}
+	if f.Status != "" {
+		code := strconv.Itoa(ex.Status)
+		if len(f.Status) == 3 && strings.HasSuffix(strings.ToLower(f.Status), "xx") {
+			return code[:1] == f.Status[:1]
+		}
+		return code == f.Status
+	}
+	return true
+}
+
+// Store keeps the most recent exchanges for each route in memory
+type Store struct {
+	mu       sync.RWMutex
+	rings    map[string]*ring
+	capacity int
+	nextID   uint64
+}
+
+// NewStore creates a store that keeps up to capacity exchanges per route
+func NewStore(capacity int) *Store {
+	return &Store{
+		rings:    make(map[string]*ring),
+		capacity: capacity,
+	}
+}
+
+// Begin starts capturing a request for a route. It records the request
+// metadata and replaces r.Body so the body is captured as the upstream
+// reads it.
+func (s *Store) Begin(route string, r *http.Request) *Exchange {
+	s.mu.Lock()
+	s.nextID++
+	id := s.nextID
+	s.mu.Unlock()
+
+	ex := &Exchange{
+		ID:            id,
+		Route:         route,
+		ClientAddr:    r.RemoteAddr,
+		Started:       time.Now(),
+		Method:        r.Method,
+		URL:           "https://" + r.Host + r.URL.RequestURI(),
+		Proto:         r.Proto,
+		RequestHeader: r.Header.Clone(),
+		requestBody:   &bodyBuffer{},
+		requestLength: r.ContentLength,
+		tracer:        &tracer{},
+	}
+	if rp := replayFromContext(r.Context()); rp != nil {
+		ex.ReplayOf = rp.Original.ID
+		rp.Exchange = ex
+	}
+
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &teeBody{ReadCloser: r.Body, buf: ex.requestBody}
+	} else {
+		ex.requestBody.finish()
+	}
+
+	return ex
+}
+
+// Finish completes an exchange and adds it to its route's buffer
+func (s *Store) Finish(ex *Exchange, rec *Recorder) {
+	end := time.Now()
+	ex.Duration = end.Sub(ex.Started)
+	ex.Timings = ex.tracer.timings(end)
+	ex.RequestBody, ex.RequestSize, ex.RequestBodyTruncated = ex.requestBody.snapshot()
+	ex.RequestBodyUnread = !ex.requestBody.finished() &&
+		(ex.requestLength < 0 || ex.RequestSize < ex.requestLength)
+
+	if rec != nil {
+		ex.Status = rec.status
+		ex.ResponseHeader = rec.header
+		ex.ResponseBody, ex.ResponseSize, ex.ResponseBodyTruncated = rec.body.snapshot()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rg, ok := s.rings[ex.Route]
+	if !ok {
+		rg = newRing(s.capacity)
+		s.rings[ex.Route] = rg
+	}
+	rg.add(ex)
+}
+
+// Get returns the exchange with the given ID
+func (s *Store) Get(id uint64) (*Exchange, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, rg := range s.rings {
+		if ex := rg.find(id); ex != nil {
+			return ex, true
+		}
+	}
+	return nil, false
+}
+
+// List returns the exchanges matching the filter, newest first
+func (s *Store) List(f Filter) []*Exchange {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var list []*Exchange
+	for _, rg := range s.rings {
+		for _, ex := range rg.items() {
+			if f.Match(ex) {
+				list = append(list, ex)
+			}
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID > list[j].ID
+	})
+	return list
+}
+
+// Replays returns the replays of an exchange, oldest first
+func (s *Store) Replays(id uint64) []*Exchange {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var list []*Exchange
+	for _, rg := range s.rings {
+		for _, ex := range rg.items() {
+			if ex.ReplayOf == id {
+				list = append(list, ex)
+			}
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID < list[j].ID
+	})
+	return list
+}
+
+// Routes returns the routes that have captured traffic
+func (s *Store) Routes() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	routes := make([]string, 0, len(s.rings))
+	for route := range s.rings {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// Clear drops all exchanges captured for a route
+func (s *Store) Clear(route string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.rings, route)
+}
+
+// ring is a fixed-size buffer that overwrites its oldest entry
+type ring struct {
+	buf  []*Exchange
+	next int
+	full bool
+}
+
+// newRing creates a ring holding up to size exchanges
+func newRing(size int) *ring {
+	return &ring{buf: make([]*Exchange, size)}
+}
+
+// add stores an exchange, evicting the oldest when full
+func (rg *ring) add(ex *Exchange) {
+	rg.buf[rg.next] = ex
+	rg.next = (rg.next + 1) % len(rg.buf)
+	if rg.next == 0 {
+		rg.full = true
+	}
+}
+
+// items returns the stored exchanges, oldest first
+func (rg *ring) items() []*Exchange {
+	if !rg.full {
+		return rg.buf[:rg.next]
+	}
+	items := make([]*Exchange, 0, len(rg.buf))
+	items = append(items, rg.buf[rg.next:]...)
+	return append(items, rg.buf[:rg.next]...)
+}
+
+// find returns the exchange with the given ID, or nil
+func (rg *ring) find(id uint64) *Exchange {
+	for _, ex := range rg.buf {
+		if ex != nil && ex.ID == id {
+			return ex
+		}
+	}
+	return nil
+}
+
+type (
+	contextKey struct{}
+	replayKey  struct{}
+)
+
+// WithExchange returns a context carrying the exchange being captured
+func WithExchange(ctx context.Context, ex *Exchange) context.Context {
+	return context.WithValue(ctx, contextKey{}, ex)
+}
+
+// FromContext returns the exchange carried by ctx, or nil
+func FromContext(ctx context.Context) *Exchange {
+	ex, _ := ctx.Value(contextKey{}).(*Exchange)
+	return ex
+}
+
+// Replay links a resent request to the exchange it replays. Exchange is
+// set once the resent request is captured.
+type Replay struct {
+	Original *Exchange
+	Exchange *Exchange
+}
+
+// WithReplay returns a context marking the request as a replay
+func WithReplay(ctx context.Context, rp *Replay) context.Context {
+	return context.WithValue(ctx, replayKey{}, rp)
+}
+
+// replayFromContext returns the replay carried by ctx, or nil
+func replayFromContext(ctx context.Context) *Replay {
+	rp, _ := ctx.Value(replayKey{}).(*Replay)
+	return rp
+}
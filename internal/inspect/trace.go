@@ -0,0 +1,91 @@
+package inspect
+
+import (
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings breaks down the upstream round trip. Phases that did not happen,
+// such as DNS and connect on a reused connection, are -1.
+type Timings struct {
+	Blocked time.Duration `json:"blocked"`
+	DNS     time.Duration `json:"dns"`
+	Connect time.Duration `json:"connect"`
+	TLS     time.Duration `json:"tls"`
+	Send    time.Duration `json:"send"`
+	Wait    time.Duration `json:"wait"`
+	Receive time.Duration `json:"receive"`
+}
+
+// tracer collects httptrace events, which arrive on transport goroutines
+type tracer struct {
+	mu sync.Mutex
+
+	getConn, gotConn   time.Time
+	dnsStart, dnsDone  time.Time
+	connStart, connEnd time.Time
+	tlsStart, tlsDone  time.Time
+	wroteRequest       time.Time
+	firstByte          time.Time
+}
+
+// Trace returns a client trace that records the upstream timings of ex.
+// Attach it to the outgoing request with httptrace.WithClientTrace.
+func (ex *Exchange) Trace() *httptrace.ClientTrace {
+	t := ex.tracer
+	mark := func(field *time.Time, keepFirst bool) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if keepFirst && !field.IsZero() {
+			return
+		}
+		*field = time.Now()
+	}
+
+	return &httptrace.ClientTrace{
+		GetConn:              func(string) { mark(&t.getConn, true) },
+		GotConn:              func(httptrace.GotConnInfo) { mark(&t.gotConn, false) },
+		DNSStart:             func(httptrace.DNSStartInfo) { mark(&t.dnsStart, true) },
+		DNSDone:              func(httptrace.DNSDoneInfo) { mark(&t.dnsDone, false) },
+		ConnectStart:         func(string, string) { mark(&t.connStart, true) },
+		ConnectDone:          func(string, string, error) { mark(&t.connEnd, false) },
+		TLSHandshakeStart:    func() { mark(&t.tlsStart, true) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { mark(&t.tlsDone, false) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { mark(&t.wroteRequest, false) },
+		GotFirstResponseByte: func() { mark(&t.firstByte, true) },
+	}
+}
+
+// timings computes the phase durations once the response is complete
+func (t *tracer) timings(end time.Time) Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	span := func(start, stop time.Time) time.Duration {
+		if start.IsZero() || stop.IsZero() || stop.Before(start) {
+			return -1
+		}
+		return stop.Sub(start)
+	}
+
+	// Time spent waiting for a connection before any dialing started
+	firstDial := t.dnsStart
+	if firstDial.IsZero() {
+		firstDial = t.connStart
+	}
+	if firstDial.IsZero() {
+		firstDial = t.gotConn
+	}
+
+	return Timings{
+		Blocked: span(t.getConn, firstDial),
+		DNS:     span(t.dnsStart, t.dnsDone),
+		Connect: span(t.connStart, t.connEnd),
+		TLS:     span(t.tlsStart, t.tlsDone),
+		Send:    span(t.gotConn, t.wroteRequest),
+		Wait:    span(t.wroteRequest, t.firstByte),
+		Receive: span(t.firstByte, end),
+	}
+}
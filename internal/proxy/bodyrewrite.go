@@ -0,0 +1,264 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// decodable lists the content codings the body rewriter can decode
+var decodable = []string{"gzip", "x-gzip", "br"}
+
+// acceptEncoding narrows a client's Accept-Encoding to codings the
+// rewriter can decode, so responses it passes through untouched, such as
+// images, are still in a coding the client accepts. It returns "" when
+// none are left.
+func acceptEncoding(header string) string {
+	var kept []string
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if !slices.Contains(decodable, coding) || refused(params) {
+			continue
+		}
+		kept = append(kept, strings.TrimSpace(part))
+	}
+	return strings.Join(kept, ", ")
+}
+
+// refused reports whether Accept-Encoding parameters carry q=0
+func refused(params string) bool {
+	for _, param := range strings.Split(params, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "q") {
+			q, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			return err == nil && q == 0
+		}
+	}
+	return false
+}
+
+// origin is an upstream spelling of the route origin and its public form
+type origin struct {
+	from []byte
+	to   []byte
+}
+
+// bodyOrigins lists the ways a page can spell the upstream origin, with the
+// public origin each one maps to
+func (o *originRewriter) bodyOrigins() []origin {
+	var origins []origin
+	add := func(from, to string) {
+		origins = append(origins, origin{from: []byte(from), to: []byte(to)})
+	}
+
+	for _, host := range []string{"localhost", "127.0.0.1", "[::1]"} {
+		hostPort := host + ":" + o.port
+		add("http://"+hostPort, "https://"+o.publicHost)
+		add("ws://"+hostPort, "wss://"+o.publicHost)
+		// JSON-encoded URLs escape the slashes
+		add(`http:\/\/`+hostPort, `https:\/\/`+o.publicHost)
+		add(`ws:\/\/`+hostPort, `wss:\/\/`+o.publicHost)
+		// Protocol-relative URLs
+		add("//"+hostPort, "//"+o.publicHost)
+	}
+	return origins
+}
+
+// rewriteBody replaces upstream origins in text responses as they stream
+// through. Compressed bodies are decoded and sent on uncompressed, since
+// the browser is on the same machine, and Content-Length is dropped
+// because the rewritten length is not known up front.
+func (o *originRewriter) rewriteBody(resp *http.Response) error {
+	if !rewritableResponse(resp) {
+		return nil
+	}
+
+	var body io.Reader
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "", "identity":
+		body = resp.Body
+	case "gzip", "x-gzip":
+		body = &gzipReader{src: resp.Body}
+	case "br":
+		body = brotli.NewReader(resp.Body)
+	default:
+		// Encodings the rewriter can't decode pass through untouched
+		return nil
+	}
+
+	resp.Body = &readCloser{
+		Reader: newOriginReplacer(body, o.bodyOrigins()),
+		Closer: resp.Body,
+	}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	return nil
+}
+
+// rewritableResponse reports whether a response carries a text body that
+// may embed absolute URLs
+func rewritableResponse(resp *http.Response) bool {
+	if resp.Request != nil && resp.Request.Method == http.MethodHead {
+		return false
+	}
+
+	switch resp.StatusCode {
+	case http.StatusSwitchingProtocols, http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case mediaType == "text/event-stream":
+		return false
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case strings.HasSuffix(mediaType, "javascript"),
+		strings.HasSuffix(mediaType, "json"),
+		strings.HasSuffix(mediaType, "xml"):
+		return true
+	}
+	return false
+}
+
+// readCloser pairs a rewritten reader with the original body's Close
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// gzipReader decodes a gzip body, reading the header on the first Read
+// rather than up front. An empty body, as on a labelled redirect, reads
+// as empty instead of failing the response.
+type gzipReader struct {
+	src io.Reader
+	zr  *gzip.Reader
+	err error
+}
+
+// Read implements io.Reader
+func (g *gzipReader) Read(p []byte) (int, error) {
+	if g.zr == nil && g.err == nil {
+		g.zr, g.err = gzip.NewReader(g.src)
+	}
+	if g.err != nil {
+		return 0, g.err
+	}
+	return g.zr.Read(p)
+}
+
+// originReplacer is a streaming reader that replaces origins in src. It
+// holds back enough bytes to match an origin split across reads, and only
+// replaces an origin when it isn't followed by another port digit.
+type originReplacer struct {
+	src     io.Reader
+	origins []origin
+	maxLen  int
+	first   [256]bool // first bytes of all origins
+
+	pending []byte // read from src, not yet scanned
+	out     []byte // scanned, not yet returned
+	buf     []byte
+	err     error
+}
+
+// newOriginReplacer creates a replacer reading from src
+func newOriginReplacer(src io.Reader, origins []origin) *originReplacer {
+	r := &originReplacer{
+		src:     src,
+		origins: origins,
+		buf:     make([]byte, 32*1024),
+	}
+	for _, o := range origins {
+		r.maxLen = max(r.maxLen, len(o.from))
+		r.first[o.from[0]] = true
+	}
+	return r
+}
+
+// Read implements io.Reader
+func (r *originReplacer) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+
+		n, err := r.src.Read(r.buf)
+		r.pending = append(r.pending, r.buf[:n]...)
+		if err != nil {
+			r.err = err
+		}
+		r.scan(r.err != nil)
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// scan moves pending bytes to out, replacing origins. Unless final, the
+// last maxLen bytes stay pending in case an origin continues in the next
+// read.
+func (r *originReplacer) scan(final bool) {
+	data := r.pending
+	limit := len(data)
+	if !final {
+		limit -= r.maxLen
+	}
+
+	i, start := 0, 0
+	for i < limit {
+		if !r.first[data[i]] {
+			i++
+			continue
+		}
+
+		o := r.match(data[i:], final)
+		if o == nil {
+			i++
+			continue
+		}
+
+		r.out = append(r.out, data[start:i]...)
+		r.out = append(r.out, o.to...)
+		i += len(o.from)
+		start = i
+	}
+
+	r.out = append(r.out, data[start:i]...)
+	r.pending = append(r.pending[:0:0], data[i:]...)
+}
+
+// match returns the origin at the start of data, or nil
+func (r *originReplacer) match(data []byte, final bool) *origin {
+	for k := range r.origins {
+		o := &r.origins[k]
+		if !bytes.HasPrefix(data, o.from) {
+			continue
+		}
+
+		// http://localhost:3000 must not match http://localhost:30001
+		if len(data) > len(o.from) {
+			if next := data[len(o.from)]; next >= '0' && next <= '9' {
+				continue
+			}
+		} else if !final {
+			continue
+		}
+		return o
+	}
+	return nil
+}
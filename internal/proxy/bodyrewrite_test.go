@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"testing"
+)
+
+// rewrittenBody runs a response with the given encoding and body through
+// the body rewriter for app.blast in front of localhost:3000
+func rewrittenBody(t *testing.T, status int, encoding string, body []byte) string {
+	t.Helper()
+
+	resp := &http.Response{
+		StatusCode: status,
+		Header: http.Header{
+			"Content-Type":     {"text/html"},
+			"Content-Encoding": {encoding},
+		},
+		Body: io.NopCloser(bytes.NewReader(body)),
+	}
+
+	o := newOriginRewriter("app.blast", "3000", "", true)
+	if err := o.rewriteBody(resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("Content-Encoding left as %q", resp.Header.Get("Content-Encoding"))
+	}
+
+	out, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestRewriteBodyGzip(t *testing.T) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	io.WriteString(zw, `<a href="http://localhost:3000/login">`)
+	zw.Close()
+
+	got := rewrittenBody(t, http.StatusOK, "gzip", buf.Bytes())
+	if want := `<a href="https://app.blast/login">`; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRewriteBodyEmptyGzip(t *testing.T) {
+	if got := rewrittenBody(t, http.StatusFound, "gzip", nil); got != "" {
+		t.Errorf("got %q, want an empty body", got)
+	}
+}
+
+func TestAcceptEncoding(t *testing.T) {
+	for header, want := range map[string]string{
+		"gzip, deflate, br, zstd": "gzip, br",
+		"gzip":                    "gzip",
+		"br;q=1.0, gzip;q=0":      "br;q=1.0",
+		"deflate":                 "",
+		"identity":                "",
+		"GZIP":                    "GZIP",
+	} {
+		if got := acceptEncoding(header); got != want {
+			t.Errorf("acceptEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// getCertificate returns the certificate for a TLS handshake, issuing it
+// on the first handshake for a route. The server lock is only held for
+// lookups, so generating a key never blocks requests for other routes.
+func (s *Server) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	host := canonicalHost(hello.ServerName)
+
+	s.mu.RLock()
+	if host == s.dashboardDomain {
+		cert := s.dashboardCert
+		s.mu.RUnlock()
+		return &cert, nil
+	}
+	s.mu.RUnlock()
+
+	rt, _, _, ok := s.lookupRoute(host)
+	if !ok {
+		return nil, fmt.Errorf("no certificate for %s", hello.ServerName)
+	}
+
+	s.mu.RLock()
+	cert := rt.cert
+	s.mu.RUnlock()
+
+	if cert != nil {
+		return cert, nil
+	}
+	return s.issueCert(hello.Context(), rt)
+}
+
+// issueCert gets a route's certificate from the store and caches it on the
+// route. Concurrent calls for the same names share one issuance.
+func (s *Server) issueCert(ctx context.Context, rt *route) (*tls.Certificate, error) {
+	tlsCert, err := s.issuing.do(ctx, strings.Join(rt.names, ","), func() (tls.Certificate, error) {
+		return s.store.Get(rt.names...)
+	})
+	if err != nil {
+		log.Printf("Failed to issue certificate for %s: %v", rt.names[0], err)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	rt.cert = &tlsCert
+	s.mu.Unlock()
+
+	return &tlsCert, nil
+}
+
+// issuer runs one certificate issuance per key at a time; later callers
+// wait for the running one and share its result
+type issuer struct {
+	mu    sync.Mutex
+	calls map[string]*issueCall
+}
+
+// issueCall is an issuance in progress
+type issueCall struct {
+	done chan struct{}
+	cert tls.Certificate
+	err  error
+}
+
+// do runs issue for key, or waits for the call already running for it.
+// A waiter gives up when ctx is done; the issuance itself carries on.
+func (g *issuer) do(ctx context.Context, key string, issue func() (tls.Certificate, error)) (tls.Certificate, error) {
+	g.mu.Lock()
+	call, running := g.calls[key]
+	if !running {
+		if g.calls == nil {
+			g.calls = make(map[string]*issueCall)
+		}
+		call = &issueCall{done: make(chan struct{})}
+		g.calls[key] = call
+	}
+	g.mu.Unlock()
+
+	if !running {
+		go func() {
+			call.cert, call.err = issue()
+
+			g.mu.Lock()
+			delete(g.calls, key)
+			g.mu.Unlock()
+			close(call.done)
+		}()
+	}
+
+	select {
+	case <-call.done:
+		return call.cert, call.err
+	case <-ctx.Done():
+		return tls.Certificate{}, ctx.Err()
+	}
+}
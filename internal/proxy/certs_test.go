@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/doganarif/blast/internal/ca"
+)
+
+func TestConcurrentHandshakesShareIssuance(t *testing.T) {
+	s, caDir := newTestServer(t)
+	for _, domain := range []string{"app.blast", "idle.blast"} {
+		if err := s.AddRoute(domain, "3000"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Routes get no certificate until a client asks for one
+	leaves := filepath.Join(caDir, "leaves")
+	if entries, _ := os.ReadDir(leaves); len(entries) != 0 {
+		t.Fatalf("%d certificates issued before any handshake", len(entries))
+	}
+
+	srv := httptest.NewUnstartedServer(http.NotFoundHandler())
+	srv.TLS = &tls.Config{GetCertificate: s.getCertificate}
+	srv.StartTLS()
+	defer srv.Close()
+
+	rootCA, err := ca.EnsureCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCA.Cert)
+
+	const handshakes = 50
+	leafCerts := make([][]byte, handshakes)
+	var wg sync.WaitGroup
+	for i := range handshakes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			conn, err := tls.Dial("tcp", srv.Listener.Addr().String(), &tls.Config{
+				RootCAs:    roots,
+				ServerName: "app.blast",
+			})
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			leafCerts[i] = conn.ConnectionState().PeerCertificates[0].Raw
+		}()
+	}
+	wg.Wait()
+
+	for i, der := range leafCerts {
+		if !bytes.Equal(der, leafCerts[0]) {
+			t.Fatalf("handshake %d got a different certificate", i)
+		}
+	}
+
+	entries, err := os.ReadDir(leaves)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		t.Fatalf("want one stored certificate, got %v", names)
+	}
+
+	s.mu.RLock()
+	idle := s.routes["idle.blast"].cert
+	s.mu.RUnlock()
+	if idle != nil {
+		t.Error("a route nobody connected to got a certificate")
+	}
+}
+
+func TestHandshakeUnknownHost(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	_, err := s.getCertificate(&tls.ClientHelloInfo{ServerName: "missing.blast"})
+	if err == nil {
+		t.Error("expected no certificate for an unknown host")
+	}
+}
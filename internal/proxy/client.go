@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/doganarif/blast/internal/ca"
+	"github.com/doganarif/blast/internal/config"
+	"github.com/doganarif/blast/internal/inspect"
+)
+
+// Client talks to the inspector API of a running daemon
+type Client struct {
+	http   *http.Client
+	domain string // the dashboard host
+}
+
+// NewClient creates a client that trusts the Blast CA. It always dials the
+// local daemon on its configured address and port, so it works before the
+// dashboard hosts entry exists.
+func NewClient(rootCA *ca.CA, cfg *config.Config) *Client {
+	pool := x509.NewCertPool()
+	pool.AddCert(rootCA.Cert)
+
+	daemonAddr := net.JoinHostPort(dialAddress(cfg.GetBindAddresses()[0]), cfg.GetHTTPSPort())
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, daemonAddr)
+		},
+	}
+
+	return &Client{
+		http:   &http.Client{Transport: transport, Timeout: 30 * time.Second},
+		domain: config.DashboardDomain(cfg.GetTLD()),
+	}
+}
+
+// dialAddress maps a bind address to one a local client can connect to
+func dialAddress(bind string) string {
+	ip := net.ParseIP(bind)
+	switch {
+	case ip == nil, ip.Equal(net.IPv4zero):
+		return "127.0.0.1"
+	case ip.Equal(net.IPv6unspecified):
+		return "::1"
+	}
+	return bind
+}
+
+// HAR downloads the captured traffic for a domain as an HTTP Archive.
+// An empty domain exports every route.
+func (c *Client) HAR(domain string) ([]byte, error) {
+	return c.get("/api/har?route=" + url.QueryEscape(domain))
+}
+
+// Replay resends a captured exchange with optional edits and returns the
+// new exchange
+func (c *Client) Replay(id uint64, opts ReplayOptions) (*inspect.Exchange, error) {
+	payload, err := json.Marshal(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	path := "/api/exchanges/" + strconv.FormatUint(id, 10) + "/replay"
+	body, err := c.do(http.MethodPost, path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	var ex inspect.Exchange
+	if err := json.Unmarshal(body, &ex); err != nil {
+		return nil, fmt.Errorf("invalid replay response: %w", err)
+	}
+	return &ex, nil
+}
+
+// get fetches a dashboard path and returns the response body
+func (c *Client) get(path string) ([]byte, error) {
+	return c.do(http.MethodGet, path, nil)
+}
+
+// do sends a request to the dashboard and returns the response body
+func (c *Client) do(method, path string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, "https://"+c.domain+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach daemon: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("daemon returned %s: %s", resp.Status, data)
+	}
+	return data, nil
+}
@@ -0,0 +1,281 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/doganarif/blast/internal/inspect"
+	"github.com/doganarif/blast/internal/system"
+)
+
+// dashboardHost returns the host the traffic inspector is served on
+func (s *Server) dashboardHost() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.dashboardDomain
+}
+
+// setDashboardDomain moves the traffic inspector to a new host, as when
+// the global TLD changes. A running server gets a certificate for the new
+// host first and then swaps its name entry. Once privileges are dropped
+// the entry can't be written; the TLD migration moves it instead.
+func (s *Server) setDashboardDomain(domain string) error {
+	s.mu.RLock()
+	old, running := s.dashboardDomain, s.server != nil
+	s.mu.RUnlock()
+
+	if old == domain {
+		return nil
+	}
+
+	if !running {
+		s.mu.Lock()
+		s.dashboardDomain = domain
+		s.mu.Unlock()
+		return nil
+	}
+
+	dashboardCert, err := s.store.Get(domain)
+	if err != nil {
+		return fmt.Errorf("failed to generate dashboard certificate: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.dashboardDomain = domain
+	s.dashboardCert = dashboardCert
+	if system.PrivilegesDropped() {
+		return nil
+	}
+	if err := s.names.Remove(old); err != nil {
+		log.Printf("Failed to remove name entry for %s: %v", old, err)
+	}
+	s.addDashboardName()
+	return nil
+}
+
+// newDashboard returns the handler for the traffic inspector. It is only
+// served to clients on this machine, since captures hold credentials, and
+// cross-origin POSTs are rejected so other sites can't trigger replays.
+func (s *Server) newDashboard() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.handleDashboard)
+	mux.HandleFunc("GET /exchanges/{id}", s.handleExchangePage)
+	mux.HandleFunc("POST /exchanges/{id}/replay", s.handleReplayPage)
+	mux.HandleFunc("GET /api/exchanges", s.handleExchangeList)
+	mux.HandleFunc("GET /api/exchanges/{id}", s.handleExchange)
+	mux.HandleFunc("POST /api/exchanges/{id}/replay", s.handleReplay)
+	mux.HandleFunc("GET /api/har", s.handleHAR)
+	return localOnly(http.NewCrossOriginProtection().Handler(mux))
+}
+
+// localOnly rejects requests that don't come from a loopback address
+func localOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			http.Error(w, "The traffic inspector is only available from this machine", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// filterFromQuery reads the route, method and status filters from the URL
+func filterFromQuery(r *http.Request) inspect.Filter {
+	q := r.URL.Query()
+	return inspect.Filter{
+		Route:  q.Get("route"),
+		Method: q.Get("method"),
+		Status: q.Get("status"),
+	}
+}
+
+// exchangeFromPath looks up the exchange named by the {id} path segment
+func (s *Server) exchangeFromPath(w http.ResponseWriter, r *http.Request) (*inspect.Exchange, bool) {
+	id, err := strconv.ParseUint(r.PathValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid exchange ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	ex, ok := s.captures.Get(id)
+	if !ok {
+		http.Error(w, "Exchange not found", http.StatusNotFound)
+		return nil, false
+	}
+	return ex, true
+}
+
+// handleDashboard renders the filtered exchange list
+func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	filter := filterFromQuery(r)
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardPages.ExecuteTemplate(w, "list", struct {
+		Filter    inspect.Filter
+		Routes    []string
+		Methods   []string
+		Statuses  []string
+		Exchanges []*inspect.Exchange
+	}{
+		Filter:    filter,
+		Routes:    s.captures.Routes(),
+		Methods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
+		Statuses:  []string{"2xx", "3xx", "4xx", "5xx"},
+		Exchanges: s.captures.List(filter),
+	})
+}
+
+// handleExchangePage renders a single exchange
+func (s *Server) handleExchangePage(w http.ResponseWriter, r *http.Request) {
+	ex, ok := s.exchangeFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardPages.ExecuteTemplate(w, "exchange", struct {
+		*inspect.Exchange
+		Replays []*inspect.Exchange
+	}{
+		Exchange: ex,
+		Replays:  s.captures.Replays(ex.ID),
+	})
+}
+
+// handleExchangeList serves the filtered exchange list as JSON
+func (s *Server) handleExchangeList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.captures.List(filterFromQuery(r)))
+}
+
+// handleExchange serves a single exchange as JSON
+func (s *Server) handleExchange(w http.ResponseWriter, r *http.Request) {
+	if ex, ok := s.exchangeFromPath(w, r); ok {
+		writeJSON(w, ex)
+	}
+}
+
+// handleHAR serves the filtered exchanges as an HTTP Archive download
+func (s *Server) handleHAR(w http.ResponseWriter, r *http.Request) {
+	filter := filterFromQuery(r)
+
+	name := "blast.har"
+	if filter.Route != "" {
+		name = filter.Route + ".har"
+	}
+
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	writeJSON(w, inspect.NewHAR(s.captures.List(filter)))
+}
+
+// writeJSON writes v as an indented JSON response
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+// displayBody renders a captured body as text when it is readable
+func displayBody(body []byte, header http.Header) string {
+	if len(body) == 0 {
+		return ""
+	}
+	if enc := header.Get("Content-Encoding"); enc != "" && enc != "identity" {
+		return "(" + enc + "-encoded body)"
+	}
+	if !utf8.Valid(body) {
+		return "(binary body)"
+	}
+	return string(body)
+}
+
+var dashboardPages = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"body": displayBody,
+}).Parse(`
+{{define "head"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Blast inspector</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; font-size: 0.9em; }
+th, td { text-align: left; padding: 0.3em 0.6em; border-bottom: 1px solid #eee; }
+td.url { word-break: break-all; }
+.s2 { color: #1a7f37; } .s3 { color: #0969da; } .s4 { color: #9a6700; } .s5, .err { color: #cf222e; }
+pre { background: #f4f4f4; border-radius: 4px; padding: 1em; white-space: pre-wrap; word-break: break-all; }
+form { margin-bottom: 1em; }
+</style>
+</head>
+<body>
+<h1><a href="/">&#9889; Blast inspector</a></h1>
+{{end}}
+
+{{define "foot"}}</body>
+</html>
+{{end}}
+
+{{define "status"}}{{if .Error}}<span class="err">error</span>{{else}}<span class="s{{slice (printf "%d" .Status) 0 1}}">{{.Status}}</span>{{end}}{{end}}
+
+{{define "list"}}{{template "head"}}
+<form method="get" action="/">
+<select name="route"><option value="">All routes</option>{{range .Routes}}<option{{if eq . $.Filter.Route}} selected{{end}}>{{.}}</option>{{end}}</select>
+<select name="method"><option value="">All methods</option>{{range .Methods}}<option{{if eq . $.Filter.Method}} selected{{end}}>{{.}}</option>{{end}}</select>
+<select name="status"><option value="">All statuses</option>{{range .Statuses}}<option{{if eq . $.Filter.Status}} selected{{end}}>{{.}}</option>{{end}}</select>
+<button type="submit">Filter</button>
+<a href="/api/har?route={{.Filter.Route}}&amp;method={{.Filter.Method}}&amp;status={{.Filter.Status}}">Download HAR</a>
+</form>
+<table>
+<tr><th>#</th><th>Time</th><th>Method</th><th>URL</th><th>Status</th><th>Size</th><th>Duration</th></tr>
+{{range .Exchanges}}<tr>
+<td><a href="/exchanges/{{.ID}}">{{.ID}}</a></td>
+<td>{{.Started.Format "15:04:05.000"}}</td>
+<td>{{.Method}}</td>
+<td class="url">{{.URL}}</td>
+<td>{{template "status" .}}</td>
+<td>{{.ResponseSize}}</td>
+<td>{{.Duration}}</td>
+</tr>{{else}}<tr><td colspan="7">No captured traffic yet.</td></tr>{{end}}
+</table>
+{{template "foot"}}{{end}}
+
+{{define "exchange"}}{{template "head"}}
+<h2>{{.Method}} {{.URL}}</h2>
+<p>{{template "status" .}} &middot; {{.Started.Format "2006-01-02 15:04:05.000"}} &middot; {{.Duration}} &middot; from {{.ClientAddr}} to <code>{{.Upstream}}</code></p>
+{{if .ReplayOf}}<p>Replay of <a href="/exchanges/{{.ReplayOf}}">#{{.ReplayOf}}</a></p>{{end}}
+<form method="post" action="/exchanges/{{.ID}}/replay"><button type="submit">Replay</button></form>
+{{if .Error}}<pre class="err">{{.Error}}</pre>{{end}}
+{{if .Replays}}<h3>Replays</h3>
+<table>
+<tr><th>#</th><th>Time</th><th>Status</th><th>Size</th><th>Duration</th></tr>
+<tr><td>original</td><td>{{.Started.Format "15:04:05.000"}}</td><td>{{template "status" .}}</td><td>{{.ResponseSize}}</td><td>{{.Duration}}</td></tr>
+{{range .Replays}}<tr>
+<td><a href="/exchanges/{{.ID}}">{{.ID}}</a></td>
+<td>{{.Started.Format "15:04:05.000"}}</td>
+<td>{{template "status" .}}</td>
+<td>{{.ResponseSize}}</td>
+<td>{{.Duration}}</td>
+</tr>{{end}}
+</table>{{end}}
+<h3>Request headers</h3>
+<pre>{{range $k, $v := .RequestHeader}}{{range $v}}{{$k}}: {{.}}
+{{end}}{{end}}</pre>
+{{with body .RequestBody .RequestHeader}}<h3>Request body{{if $.RequestBodyTruncated}} (truncated, {{$.RequestSize}} bytes){{end}}{{if $.RequestBodyUnread}} (not fully read by the upstream){{end}}</h3>
+<pre>{{.}}</pre>{{end}}
+<h3>Response headers</h3>
+<pre>{{range $k, $v := .ResponseHeader}}{{range $v}}{{$k}}: {{.}}
+{{end}}{{end}}</pre>
+{{with body .ResponseBody .ResponseHeader}}<h3>Response body{{if $.ResponseBodyTruncated}} (truncated, {{$.ResponseSize}} bytes){{end}}</h3>
+<pre>{{.}}</pre>{{end}}
+{{template "foot"}}{{end}}
+`))
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/doganarif/blast/internal/config"
+)
+
+func TestDashboardLocalOnly(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	for addr, want := range map[string]int{
+		"127.0.0.1:50000":   http.StatusOK,
+		"[::1]:50000":       http.StatusOK,
+		"192.168.1.20:5000": http.StatusForbidden,
+		"[fe80::1]:50000":   http.StatusForbidden,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "https://"+s.dashboardHost()+"/api/exchanges", nil)
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		s.handleRequest(w, r)
+		if w.Code != want {
+			t.Errorf("%s: got status %d, want %d", addr, w.Code, want)
+		}
+	}
+}
+
+func TestDashboardRejectsCrossOriginReplay(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	r := httptest.NewRequest(http.MethodPost, "https://"+s.dashboardHost()+"/api/exchanges/1/replay", nil)
+	r.RemoteAddr = "127.0.0.1:50000"
+	r.Header.Set("Sec-Fetch-Site", "cross-site")
+	w := httptest.NewRecorder()
+	s.handleRequest(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("cross-site replay: got status %d, want %d", w.Code, http.StatusForbidden)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "https://"+s.dashboardHost()+"/api/exchanges/1/replay", nil)
+	r.RemoteAddr = "127.0.0.1:50000"
+	r.Header.Set("Sec-Fetch-Site", "same-origin")
+	w = httptest.NewRecorder()
+	s.handleRequest(w, r)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("same-origin replay of a missing exchange: got status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
+
+func TestDashboardFollowsTLD(t *testing.T) {
+	s, _ := newTestServer(t)
+	port := startTestServer(t, s)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{
+		cfg.SetResolver(config.ResolverNone),
+		cfg.SetHTTPSPort(port),
+		cfg.SetHTTPPort(config.HTTPPortOff),
+		cfg.SetBindAddresses([]string{"127.0.0.1"}),
+		cfg.SetTLD("test"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.LoadConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.dashboardHost(); got != "blast.test" {
+		t.Fatalf("dashboard on %s, want blast.test", got)
+	}
+	if err := s.AddRoute("blast.test", "3000"); err == nil {
+		t.Error("a route took over the dashboard domain")
+	}
+	if s.hasHost("blast.blast") {
+		t.Error("blast.blast still resolves")
+	}
+
+	resp, err := testClient(t, net.JoinHostPort("127.0.0.1", port)).Get("https://blast.test/api/exchanges")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("dashboard returned %s", resp.Status)
+	}
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/doganarif/blast/internal/dns"
+	"github.com/doganarif/blast/internal/system"
+)
+
+// setDNS stores the DNS responder address and zones. The responder is
+// restarted if the server is running and the address changed, and kept
+// on its old address if the new one can't be bound. An empty address
+// turns it off.
+func (s *Server) setDNS(addr string, zones []string) error {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+
+	s.dnsZones = zones
+	if s.resolver != nil {
+		s.resolver.SetZones(zones)
+	}
+
+	if s.dnsAddr == addr {
+		return nil
+	}
+
+	if s.server == nil {
+		s.dnsAddr = addr
+		return nil
+	}
+
+	if _, port, err := net.SplitHostPort(addr); err == nil && system.PrivilegesDropped() && privilegedPort(port) {
+		return fmt.Errorf("a privileged DNS port can only be bound by restarting the daemon")
+	}
+
+	prev := s.dnsAddr
+	s.stopDNS()
+	s.dnsAddr = addr
+	if err := s.startDNS(); err != nil {
+		s.dnsAddr = prev
+		if restoreErr := s.startDNS(); restoreErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to restore previous DNS server: %w", restoreErr))
+		}
+		return err
+	}
+	return nil
+}
+
+// startDNS starts the responder for the configured names, if enabled.
+// The caller must hold lmu.
+func (s *Server) startDNS() error {
+	if s.dnsAddr == "" {
+		return nil
+	}
+
+	resolver := dns.NewServer(s.dnsAddr, s.hasHost)
+	resolver.SetAddresses(answerAddresses(s.listen.all()))
+	resolver.SetZones(s.dnsZones)
+	if err := resolver.Start(); err != nil {
+		return fmt.Errorf("failed to start DNS server: %w", err)
+	}
+
+	s.resolver = resolver
+	log.Printf("Answering DNS on %s", s.dnsAddr)
+	return nil
+}
+
+// stopDNS stops the responder if it is running. The caller must hold lmu.
+func (s *Server) stopDNS() {
+	if s.resolver != nil {
+		s.resolver.Stop()
+		s.resolver = nil
+	}
+}
+
+// hasHost reports whether the proxy serves a hostname
+func (s *Server) hasHost(name string) bool {
+	if name == s.dashboardHost() {
+		return true
+	}
+
+	_, _, _, ok := s.lookupRoute(name)
+	return ok
+}
+
+// answerAddresses picks the A and AAAA answers that reach the listeners.
+// Wildcard binds are reached through loopback; a specific address is
+// returned as is.
+func answerAddresses(addresses []string) (ipv4, ipv6 net.IP) {
+	for _, addr := range addresses {
+		ip := net.ParseIP(addr)
+		switch {
+		case ip == nil || ip.IsUnspecified():
+			// "" and "::" accept both stacks, 0.0.0.0 only IPv4
+			if ipv4 == nil {
+				ipv4 = net.IPv4(127, 0, 0, 1)
+			}
+			if ipv6 == nil && (ip == nil || ip.To4() == nil) {
+				ipv6 = net.IPv6loopback
+			}
+		case ip.To4() != nil:
+			if ipv4 == nil {
+				ipv4 = ip
+			}
+		default:
+			if ipv6 == nil {
+				ipv6 = ip
+			}
+		}
+	}
+	return ipv4, ipv6
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/doganarif/blast/internal/config"
+	"github.com/doganarif/blast/internal/inspect"
+)
+
+type headerVarsKey struct{}
+
+// headerRules are a route's header rewrite rules split by direction
+type headerRules struct {
+	request  []config.HeaderRule
+	response []config.HeaderRule
+}
+
+// newHeaderRules splits a mapping's header rules by direction
+func newHeaderRules(rules []config.HeaderRule) headerRules {
+	var hr headerRules
+	for _, rule := range rules {
+		switch rule.Direction {
+		case config.HeaderRequest:
+			hr.request = append(hr.request, rule)
+		case config.HeaderResponse:
+			hr.response = append(hr.response, rule)
+		}
+	}
+	return hr
+}
+
+// headerVars expands the placeholders allowed in header rule values
+func headerVars(r *http.Request, route string) *strings.Replacer {
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+
+	var requestID string
+	if ex := inspect.FromContext(r.Context()); ex != nil {
+		requestID = strconv.FormatUint(ex.ID, 10)
+	}
+
+	return strings.NewReplacer(
+		"{client_ip}", clientIP,
+		"{route}", route,
+		"{request_id}", requestID,
+	)
+}
+
+// withHeaderVars stores the placeholder values for response rules, which
+// only see the outgoing request
+func withHeaderVars(ctx context.Context, vars *strings.Replacer) context.Context {
+	return context.WithValue(ctx, headerVarsKey{}, vars)
+}
+
+// headerVarsFromContext returns the placeholder values stored in ctx
+func headerVarsFromContext(ctx context.Context) *strings.Replacer {
+	if vars, ok := ctx.Value(headerVarsKey{}).(*strings.Replacer); ok {
+		return vars
+	}
+	return strings.NewReplacer()
+}
+
+// applyHeaderRules applies rules to h in order
+func applyHeaderRules(h http.Header, rules []config.HeaderRule, vars *strings.Replacer) {
+	for _, rule := range rules {
+		switch rule.Action {
+		case config.HeaderSet:
+			h.Set(rule.Name, vars.Replace(rule.Value))
+		case config.HeaderAppend:
+			h.Add(rule.Name, vars.Replace(rule.Value))
+		case config.HeaderRemove:
+			h.Del(rule.Name)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/doganarif/blast/internal/daemon"
+	"github.com/doganarif/blast/internal/inspect"
+)
+
+const (
+	healthInterval = 2 * time.Second
+	healthTimeout  = 2 * time.Second
+)
+
+// Health is the last observed state of a route's upstream
+type Health struct {
+	Up        bool      `json:"up"`
+	LastError string    `json:"last_error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// String returns a short label for CLI output
+func (h Health) String() string {
+	switch {
+	case h.CheckedAt.IsZero():
+		return "unknown"
+	case h.Up:
+		return "up"
+	default:
+		return "down: " + h.LastError
+	}
+}
+
+// healthState is shared between a target and the health checker
+type healthState struct {
+	mu     sync.Mutex
+	health Health
+}
+
+// get returns the current health
+func (hs *healthState) get() Health {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	return hs.health
+}
+
+// record stores a check result and reports whether the up/down state changed
+func (hs *healthState) record(err error) bool {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+
+	prev := hs.health
+	hs.health = Health{Up: err == nil, CheckedAt: time.Now()}
+	if err != nil {
+		hs.health.LastError = err.Error()
+	}
+
+	return prev.CheckedAt.IsZero() || prev.Up != hs.health.Up || prev.LastError != hs.health.LastError
+}
+
+// HealthKey returns the key used for a route target in health reports,
+// e.g. "app.blast" or "app.blast/api"
+func HealthKey(domain, prefix string) string {
+	return domain + prefix
+}
+
+// Health returns the health of every route target, keyed by HealthKey
+func (s *Server) Health() map[string]Health {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	status := make(map[string]Health)
+	for domain, rt := range s.routes {
+		if domain != rt.names[0] {
+			continue // alias
+		}
+		for _, t := range rt.targets {
+			status[HealthKey(domain, t.prefix)] = t.health.get()
+		}
+	}
+	return status
+}
+
+// LoadHealth reads the health report last published by the daemon
+func LoadHealth() (map[string]Health, error) {
+	statusPath, err := daemon.GetStatusPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(statusPath)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make(map[string]Health)
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// watchHealth checks every upstream periodically until the server stops
+func (s *Server) watchHealth() {
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+
+	published := -1
+	for {
+		// Republish on state changes and when routes are added or removed
+		changed, count := s.checkHealth()
+		if changed || count != published {
+			if err := s.publishHealth(); err != nil {
+				log.Printf("Failed to publish health: %v", err)
+			}
+			published = count
+		}
+
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkHealth checks all upstreams concurrently. It reports whether any of
+// them changed state and how many were checked.
+func (s *Server) checkHealth() (bool, int) {
+	s.mu.RLock()
+	var targets []target
+	for domain, rt := range s.routes {
+		if domain == rt.names[0] {
+			targets = append(targets, rt.targets...)
+		}
+	}
+	s.mu.RUnlock()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		changed bool
+	)
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t target) {
+			defer wg.Done()
+			if t.health.record(t.check()) {
+				mu.Lock()
+				changed = true
+				mu.Unlock()
+			}
+		}(t)
+	}
+	wg.Wait()
+
+	return changed, len(targets)
+}
+
+// publishHealth writes the current health report for the CLI
+func (s *Server) publishHealth() error {
+	statusPath, err := daemon.GetStatusPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(s.Health(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(statusPath), 0755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(statusPath, data, 0644)
+}
+
+// check probes the upstream with a TCP connect, or an HTTP GET when the
+// route has a health path
+func (t *target) check() error {
+	if t.healthPath == "" {
+		conn, err := net.DialTimeout("tcp", t.host, healthTimeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	client := &http.Client{Transport: t.transport, Timeout: healthTimeout}
+	resp, err := client.Get("http://" + t.host + t.healthPath)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%s returned %s", t.healthPath, resp.Status)
+	}
+	return nil
+}
+
+// handleError serves the error page when the upstream cannot be reached
+func (t *target) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("Proxy error for %s%s: %v", t.domain, r.URL.Path, err)
+	if ex := inspect.FromContext(r.Context()); ex != nil {
+		ex.Error = err.Error()
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusBadGateway)
+
+	errorPage.Execute(w, struct {
+		Route string
+		Port  string
+		Error string
+	}{
+		Route: t.domain + t.prefix,
+		Port:  t.port,
+		Error: err.Error(),
+	})
+}
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Backend unavailable - {{.Route}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, sans-serif; max-width: 40em; margin: 4em auto; padding: 0 1em; color: #222; }
+h1 { font-size: 1.4em; }
+code, pre { background: #f4f4f4; border-radius: 4px; padding: 0.2em 0.4em; }
+pre { padding: 1em; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<h1>&#9889; Backend is down</h1>
+<p>Blast could not reach the server behind <code>{{.Route}}</code> on <code>localhost:{{.Port}}</code>.</p>
+<pre>{{.Error}}</pre>
+<p>Start your dev server on port {{.Port}} and reload this page.</p>
+</body>
+</html>
+`))
@@ -0,0 +1,328 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/doganarif/blast/internal/config"
+	"github.com/doganarif/blast/internal/daemon"
+	"github.com/doganarif/blast/internal/system"
+)
+
+// listenOptions are the addresses and ports the proxy binds
+type listenOptions struct {
+	addresses  []string // "" binds all interfaces on both stacks
+	companions []string // loopback of the other stack; bound if available
+	httpsPort  string
+	httpPort   string // or config.HTTPPortOff
+}
+
+// defaultListenOptions binds all interfaces on the standard ports
+func defaultListenOptions() listenOptions {
+	return listenOptions{
+		addresses: []string{""},
+		httpsPort: config.DefaultHTTPSPort,
+		httpPort:  config.DefaultHTTPPort,
+	}
+}
+
+// listenOptionsFromConfig reads the listen settings from the config
+func listenOptionsFromConfig(cfg *config.Config) listenOptions {
+	addresses := cfg.GetBindAddresses()
+	return listenOptions{
+		addresses:  addresses,
+		companions: loopbackCompanions(addresses),
+		httpsPort:  cfg.GetHTTPSPort(),
+		httpPort:   cfg.GetHTTPPort(),
+	}
+}
+
+// loopbackCompanions returns the loopback address of the other stack when
+// only one loopback is configured, so names that resolve to both 127.0.0.1
+// and ::1 work whichever one a client tries first
+func loopbackCompanions(addresses []string) []string {
+	var v4, v6 bool
+	for _, addr := range addresses {
+		if ip := net.ParseIP(addr); ip != nil && ip.IsLoopback() {
+			if ip.To4() != nil {
+				v4 = true
+			} else {
+				v6 = true
+			}
+		}
+	}
+
+	switch {
+	case v4 && !v6:
+		return []string{"::1"}
+	case v6 && !v4:
+		return []string{"127.0.0.1"}
+	}
+	return nil
+}
+
+// all returns the configured addresses followed by the companions
+func (o listenOptions) all() []string {
+	return append(slices.Clone(o.addresses), o.companions...)
+}
+
+// equal reports whether two sets of options bind the same sockets
+func (o listenOptions) equal(other listenOptions) bool {
+	return slices.Equal(o.addresses, other.addresses) &&
+		slices.Equal(o.companions, other.companions) &&
+		o.httpsPort == other.httpsPort &&
+		o.httpPort == other.httpPort
+}
+
+// hostOnly strips an optional port from a Host header
+func hostOnly(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// canonicalHost lowercases a hostname and converts Unicode labels to
+// punycode, the form routes are stored in
+func canonicalHost(host string) string {
+	if ascii, err := config.ToASCII(host); err == nil {
+		return ascii
+	}
+	return strings.ToLower(host)
+}
+
+// publicPort returns the HTTPS port to put in URLs, or "" for 443
+func (s *Server) publicPort() string {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+
+	if s.listen.httpsPort == config.DefaultHTTPSPort {
+		return ""
+	}
+	return s.listen.httpsPort
+}
+
+// setListenOptions stores new listen settings and rebinds the listeners
+// if the server is already running. If the new listeners can't be bound,
+// the previous ones are restored.
+func (s *Server) setListenOptions(opts listenOptions) error {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+
+	if s.listen.equal(opts) {
+		return nil
+	}
+
+	if s.server == nil {
+		s.listen = opts
+		return nil
+	}
+
+	// Sockets passed in by systemd can't be rebound from here
+	if s.activated {
+		s.listen = opts
+		log.Printf("Listen settings changed; restart the systemd socket unit to apply them")
+		return nil
+	}
+
+	// Once root is gone, privileged ports can't be bound again; keep the
+	// current listeners rather than closing them
+	if system.PrivilegesDropped() && opts.privileged() {
+		return fmt.Errorf("privileged ports can only be rebound by restarting the daemon")
+	}
+
+	prev := s.listen
+	s.closeListeners()
+	s.listen = opts
+	if err := s.openListeners(); err != nil {
+		s.listen = prev
+		if restoreErr := s.openListeners(); restoreErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to restore previous listeners: %w", restoreErr))
+		}
+		s.startServing()
+		return err
+	}
+	s.startServing()
+
+	if s.resolver != nil {
+		s.resolver.SetAddresses(answerAddresses(opts.all()))
+	}
+	return nil
+}
+
+// privileged reports whether any of the ports needs root to bind
+func (o listenOptions) privileged() bool {
+	if privilegedPort(o.httpsPort) {
+		return true
+	}
+	return o.httpPort != config.HTTPPortOff && privilegedPort(o.httpPort)
+}
+
+// privilegedPort reports whether a port is below 1024, which only root
+// may bind on most systems
+func privilegedPort(port string) bool {
+	n, err := strconv.Atoi(port)
+	return err == nil && n > 0 && n < 1024
+}
+
+// bindAndServe binds the listeners, drops root privileges and starts
+// serving. Sockets handed over by systemd are preferred, so the daemon
+// can run unprivileged while systemd owns the privileged ports.
+func (s *Server) bindAndServe() error {
+	s.lmu.Lock()
+	defer s.lmu.Unlock()
+
+	activated, err := s.useActivationListeners()
+	if err == nil && !activated {
+		err = s.openListeners()
+	}
+	if err != nil {
+		return err
+	}
+
+	// The DNS port may be privileged too, so bind it before dropping
+	if err := s.startDNS(); err != nil {
+		s.closeListeners()
+		return err
+	}
+
+	// Root was only needed for the ports; serve as the user behind sudo
+	if err := s.dropPrivileges(); err != nil {
+		s.stopDNS()
+		s.closeListeners()
+		return fmt.Errorf("failed to drop privileges: %w", err)
+	}
+
+	s.startServing()
+	return nil
+}
+
+// dropPrivileges switches to the user who invoked sudo. The state
+// directory is handed to that user first so the daemon can keep writing
+// its status file.
+func (s *Server) dropPrivileges() error {
+	statusPath, err := daemon.GetStatusPath()
+	if err != nil {
+		return err
+	}
+
+	stateDir := filepath.Dir(statusPath)
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		return err
+	}
+	return system.DropPrivileges(stateDir, statusPath)
+}
+
+// useActivationListeners serves sockets passed by systemd socket activation
+// instead of binding our own, matching them to HTTPS or HTTP by port.
+// Sockets on other ports are served as HTTPS. It reports whether any
+// sockets were passed. The caller must hold lmu.
+func (s *Server) useActivationListeners() (bool, error) {
+	listeners, err := system.ActivationListeners()
+	if err != nil {
+		return false, fmt.Errorf("failed to use systemd sockets: %w", err)
+	}
+	if len(listeners) == 0 {
+		return false, nil
+	}
+
+	s.activated = true
+	for _, ln := range listeners {
+		_, port, _ := net.SplitHostPort(ln.Addr().String())
+		if port == s.listen.httpPort {
+			s.serve(ln, s.redirect.Serve)
+			continue
+		}
+		s.serve(ln, func(ln net.Listener) error {
+			return s.server.ServeTLS(ln, "", "")
+		})
+	}
+
+	log.Printf("Using %d socket(s) from systemd", len(listeners))
+	return true, nil
+}
+
+// openListeners binds the HTTPS and redirect listeners on every configured
+// address and starts serving them. A failure to bind HTTPS is fatal; the
+// redirect listener and the loopback companions are optional. The caller
+// must hold lmu.
+func (s *Server) openListeners() error {
+	serveTLS := func(ln net.Listener) error {
+		return s.server.ServeTLS(ln, "", "")
+	}
+
+	for _, addr := range s.listen.addresses {
+		ln, err := net.Listen("tcp", net.JoinHostPort(addr, s.listen.httpsPort))
+		if err != nil {
+			s.closeListeners()
+			return fmt.Errorf("failed to listen for HTTPS: %w", err)
+		}
+		s.serve(ln, serveTLS)
+	}
+
+	for _, addr := range s.listen.companions {
+		ln, err := net.Listen("tcp", net.JoinHostPort(addr, s.listen.httpsPort))
+		if err != nil {
+			// The host may have one stack disabled
+			log.Printf("Not listening on %s: %v", addr, err)
+			continue
+		}
+		s.serve(ln, serveTLS)
+	}
+
+	if s.listen.httpPort == config.HTTPPortOff {
+		return nil
+	}
+
+	for _, addr := range s.listen.all() {
+		ln, err := net.Listen("tcp", net.JoinHostPort(addr, s.listen.httpPort))
+		if err != nil {
+			// Port 80 is often taken; HTTPS keeps working without it
+			log.Printf("HTTP redirect listener disabled: %v", err)
+			continue
+		}
+		s.serve(ln, s.redirect.Serve)
+	}
+
+	return nil
+}
+
+// serve tracks a bound listener and queues it to be served by the next
+// startServing, so privileges can be dropped in between. The caller must
+// hold lmu.
+func (s *Server) serve(ln net.Listener, serve func(net.Listener) error) {
+	s.listeners = append(s.listeners, ln)
+	s.pending = append(s.pending, func() {
+		err := serve(ln)
+		if err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Listener %s stopped: %v", ln.Addr(), err)
+		}
+	})
+}
+
+// startServing serves every queued listener in the background. The caller
+// must hold lmu.
+func (s *Server) startServing() {
+	for _, serve := range s.pending {
+		go serve()
+	}
+	s.pending = nil
+}
+
+// closeListeners stops accepting connections on all listeners. Open
+// connections are left to finish. The caller must hold lmu.
+func (s *Server) closeListeners() {
+	for _, ln := range s.listeners {
+		ln.Close()
+	}
+	s.listeners = nil
+	s.pending = nil
+}
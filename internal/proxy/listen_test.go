@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/doganarif/blast/internal/ca"
+	"github.com/doganarif/blast/internal/config"
+	"github.com/doganarif/blast/internal/hosts"
+)
+
+// freePort returns a TCP port that was free on addr a moment ago
+func freePort(t *testing.T, addr string) string {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", net.JoinHostPort(addr, "0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	return port
+}
+
+// startTestServer serves s over HTTPS on 127.0.0.1 and a free port, which
+// it returns. Names are not registered anywhere.
+func startTestServer(t *testing.T, s *Server) string {
+	t.Helper()
+
+	port := freePort(t, "127.0.0.1")
+	addresses := []string{"127.0.0.1"}
+	s.names, _ = hosts.New(config.ResolverNone, "", "", nil)
+	s.listen = listenOptions{
+		addresses:  addresses,
+		companions: loopbackCompanions(addresses),
+		httpsPort:  port,
+		httpPort:   config.HTTPPortOff,
+	}
+
+	errc := make(chan error, 1)
+	go func() { errc <- s.Start() }()
+	t.Cleanup(func() { s.Stop() })
+
+	waitListening(t, "127.0.0.1", port, errc)
+	return port
+}
+
+// waitListening waits until addr:port accepts connections
+func waitListening(t *testing.T, addr, port string, errc <-chan error) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		select {
+		case err := <-errc:
+			t.Fatalf("server stopped: %v", err)
+		default:
+		}
+
+		if conn, err := net.Dial("tcp", net.JoinHostPort(addr, port)); err == nil {
+			conn.Close()
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("nothing listening on %s", net.JoinHostPort(addr, port))
+}
+
+func TestSetListenOptionsRestoresListeners(t *testing.T) {
+	s, _ := newTestServer(t)
+	port := startTestServer(t, s)
+
+	// Hold the new port so the rebind fails
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	_, takenPort, _ := net.SplitHostPort(taken.Addr().String())
+
+	err = s.setListenOptions(listenOptions{
+		addresses: []string{"127.0.0.1"},
+		httpsPort: takenPort,
+		httpPort:  config.HTTPPortOff,
+	})
+	if err == nil {
+		t.Fatal("expected the rebind to fail")
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+	if err != nil {
+		t.Fatalf("previous listener not restored: %v", err)
+	}
+	conn.Close()
+
+	if s.listen.httpsPort != port {
+		t.Errorf("listen settings left at port %s, want %s", s.listen.httpsPort, port)
+	}
+}
+
+func TestIPv6ClientReachesIPv4Bind(t *testing.T) {
+	if ln, err := net.Listen("tcp", "[::1]:0"); err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	} else {
+		ln.Close()
+	}
+
+	s, _ := newTestServer(t)
+	upstream, _ := newUpstream(t)
+	if err := s.AddRoute("app.blast", upstream); err != nil {
+		t.Fatal(err)
+	}
+	port := startTestServer(t, s)
+
+	client := testClient(t, net.JoinHostPort("::1", port))
+	resp, err := client.Get("https://app.blast/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("got %s %q, want 200 \"ok\"", resp.Status, body)
+	}
+}
+
+// testClient returns an HTTPS client that trusts the test CA and connects
+// to addr whatever the URL's host
+func testClient(t *testing.T, addr string) *http.Client {
+	t.Helper()
+
+	rootCA, err := ca.EnsureCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(rootCA.Cert)
+
+	return &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots},
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, addr)
+			},
+		},
+		Timeout: 10 * time.Second,
+	}
+}
+
+func TestLoadConfigContinuesAfterListenError(t *testing.T) {
+	s, _ := newTestServer(t)
+	port := startTestServer(t, s)
+
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+	_, takenPort, _ := net.SplitHostPort(taken.Addr().String())
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{
+		cfg.SetResolver(config.ResolverNone),
+		cfg.SetHTTPSPort(takenPort),
+		cfg.SetHTTPPort(config.HTTPPortOff),
+		cfg.SetBindAddresses([]string{"127.0.0.1"}),
+		cfg.AddProxy("reload", "3000"),
+	} {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := s.LoadConfig(cfg); err == nil {
+		t.Fatal("expected the rebind to fail")
+	}
+	if !s.hasHost("reload.blast") {
+		t.Error("routes were not loaded after the listen error")
+	}
+	if s.listen.httpsPort != port {
+		t.Errorf("listen settings left at port %s, want %s", s.listen.httpsPort, port)
+	}
+}
@@ -2,58 +2,149 @@ package proxy
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"net/http/httptrace"
 	"net/http/httputil"
 	"net/url"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/doganarif/blast/internal/ca"
 	"github.com/doganarif/blast/internal/cert"
+	"github.com/doganarif/blast/internal/config"
+	"github.com/doganarif/blast/internal/dns"
+	"github.com/doganarif/blast/internal/hosts"
+	"github.com/doganarif/blast/internal/inspect"
 )
 
 // Server represents the proxy server
 type Server struct {
-	rootCA *ca.CA
-	routes map[string]string // domain -> localhost:port
-	certs  map[string]tls.Certificate
-	mu     sync.RWMutex
-	server *http.Server
+	store           *cert.Store       // issued certificates, kept across restarts
+	routes          map[string]*route // domain -> route
+	issuing         issuer            // certificates being issued, by route
+	dashboardDomain string            // host of the traffic inspector
+	dashboardCert   tls.Certificate
+	captures        *inspect.Store
+	names           hosts.Backend // makes the dashboard domain resolve
+	dashboard       http.Handler
+	listen          listenOptions
+	listeners       []net.Listener
+	pending         []func() // bound listeners waiting to be served
+	activated       bool     // listeners came from systemd socket activation
+	dnsAddr         string   // "" disables the DNS responder
+	dnsZones        []string // TLDs the responder answers for
+	resolver        *dns.Server
+	mu              sync.RWMutex
+	lmu             sync.Mutex // guards listen and listeners
+	server          *http.Server
+	redirect        *http.Server
+	done            chan struct{}
+}
+
+// route holds the upstream targets for a mapping's hostnames
+type route struct {
+	names   []string         // FullDomain first, then aliases
+	targets []target         // longest prefix first
+	cert    *tls.Certificate // nil until the first handshake; guarded by mu
+}
+
+// target is a single upstream reachable under a path prefix
+type target struct {
+	domain          string
+	prefix          string // without trailing slash; "" matches every path
+	strip           bool
+	host            string // localhost:port
+	port            string
+	healthPath      string
+	headers         headerRules
+	subdomainHeader string          // wildcard routes only
+	rewrite         *originRewriter // nil when rewriting is off
+	health          *healthState
+	proxy           *httputil.ReverseProxy
+	transport       *http.Transport
 }
 
 // NewServer creates a new proxy server
 func NewServer(rootCA *ca.CA) *Server {
-	return &Server{
-		rootCA: rootCA,
-		routes: make(map[string]string),
-		certs:  make(map[string]tls.Certificate),
+	s := &Server{
+		store:           cert.NewStore(rootCA),
+		routes:          make(map[string]*route),
+		dashboardDomain: config.DashboardDomain(config.DefaultTLD),
+		captures:        inspect.NewStore(inspect.DefaultCapacity),
+		names:           hosts.HostsFile{Path: hosts.GetHostsPath()},
+		listen:          defaultListenOptions(),
+		done:            make(chan struct{}),
 	}
+	s.dashboard = s.newDashboard()
+	return s
 }
 
 // AddRoute adds a new route mapping
 func (s *Server) AddRoute(domain, localPort string) error {
+	return s.AddMapping(config.ProxyMapping{
+		FullDomain: domain,
+		LocalPort:  localPort,
+	})
+}
+
+// AddMapping adds a route for a proxy mapping, including its path rules.
+// The route answers to the mapping's full domain and every alias, which
+// share one certificate, issued on the first TLS handshake.
+func (s *Server) AddMapping(mapping config.ProxyMapping) error {
+	names := mapping.Hostnames()
+	rt := newRoute(mapping, s.publicPort())
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// Generate certificate for the domain
-	tlsCert, err := cert.GenerateCertificate(s.rootCA, domain)
-	if err != nil {
-		return fmt.Errorf("failed to generate certificate: %w", err)
+	if slices.Contains(names, s.dashboardDomain) {
+		rt.close()
+		return fmt.Errorf("%s is reserved for the traffic inspector", s.dashboardDomain)
+	}
+
+	for _, name := range names {
+		if old, ok := s.routes[name]; ok && old.names[0] != mapping.FullDomain {
+			rt.close()
+			return fmt.Errorf("%s is already used by %s", name, old.names[0])
+		}
 	}
 
-	s.routes[domain] = "localhost:" + localPort
-	s.certs[domain] = tlsCert
+	s.removeRoute(mapping.FullDomain)
+	for _, name := range names {
+		s.routes[name] = rt
+	}
 
 	return nil
 }
 
-// RemoveRoute removes a route mapping
+// RemoveRoute removes a route mapping and its aliases
 func (s *Server) RemoveRoute(domain string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	delete(s.routes, domain)
-	delete(s.certs, domain)
+	s.removeRoute(domain)
+	s.captures.Clear(domain)
+}
+
+// removeRoute unregisters the route serving domain under all of its names.
+// The caller must hold mu.
+func (s *Server) removeRoute(domain string) {
+	rt, ok := s.routes[domain]
+	if !ok {
+		return
+	}
+
+	rt.close()
+	for _, name := range rt.names {
+		delete(s.routes, name)
+	}
 }
 
 // ClearRoutes clears all route mappings
@@ -61,72 +152,328 @@ func (s *Server) ClearRoutes() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.routes = make(map[string]string)
-	s.certs = make(map[string]tls.Certificate)
+	for _, rt := range s.routes {
+		rt.close()
+	}
+	s.routes = make(map[string]*route)
+}
+
+// LoadConfig replaces the routes with the configured proxies and applies
+// the listen settings. When the server is running and the addresses or
+// ports changed, the listeners are rebound. The daemon calls it at start
+// and on every reload. A setting that can't be applied keeps its previous
+// state; the rest of the config is still loaded and every error returned.
+func (s *Server) LoadConfig(cfg *config.Config) error {
+	var errs []error
+	if err := s.setListenOptions(listenOptionsFromConfig(cfg)); err != nil {
+		errs = append(errs, err)
+	}
+	if err := s.setDNS(cfg.GetDNSAddr(), cfg.Zones()); err != nil {
+		errs = append(errs, err)
+	}
+
+	if names, err := hosts.FromConfig(cfg); err != nil {
+		errs = append(errs, err)
+	} else {
+		s.setNames(names)
+	}
+
+	if err := s.setDashboardDomain(config.DashboardDomain(cfg.GetTLD())); err != nil {
+		errs = append(errs, err)
+	}
+
+	s.ClearRoutes()
+
+	for _, mapping := range cfg.ListProxies() {
+		if err := s.AddMapping(mapping); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", mapping.FullDomain, err))
+		}
+	}
+	return errors.Join(errs...)
 }
 
-// Start starts the proxy server on port 443
+// Start starts the proxy server and blocks until Stop is called
 func (s *Server) Start() error {
+	// The inspector dashboard is always served alongside the routes
+	dashboardCert, err := s.store.Get(s.dashboardHost())
+	if err != nil {
+		return fmt.Errorf("failed to generate dashboard certificate: %w", err)
+	}
+
+	s.mu.Lock()
+	s.dashboardCert = dashboardCert
+	s.addDashboardName()
+	s.mu.Unlock()
+
 	// Create TLS config with dynamic certificate selection
 	tlsConfig := &tls.Config{
-		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
-			s.mu.RLock()
-			defer s.mu.RUnlock()
-
-			cert, ok := s.certs[hello.ServerName]
-			if !ok {
-				return nil, fmt.Errorf("no certificate for %s", hello.ServerName)
-			}
-			return &cert, nil
-		},
+		GetCertificate: s.getCertificate,
 	}
 
-	// Create HTTP server
-	handler := http.HandlerFunc(s.handleRequest)
+	// Create HTTP servers; listeners are attached by openListeners
 	s.server = &http.Server{
-		Addr:      ":443",
-		Handler:   handler,
+		Handler:   http.HandlerFunc(s.handleRequest),
 		TLSConfig: tlsConfig,
 	}
+	s.redirect = &http.Server{
+		Handler: http.HandlerFunc(s.handleRedirect),
+	}
+
+	if err := s.bindAndServe(); err != nil {
+		return err
+	}
+
+	// Watch upstreams and certificate expiry in the background while serving
+	go s.watchHealth()
+	go s.renewCerts()
+
+	<-s.done
+	return http.ErrServerClosed
+}
+
+// setNames switches the name resolution backend, registering the
+// dashboard domain with it if the server is already running
+func (s *Server) setNames(names hosts.Backend) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.names = names
+
+	if s.server != nil {
+		s.addDashboardName()
+	}
+}
 
-	return s.server.ListenAndServeTLS("", "")
+// addDashboardName makes the dashboard domain resolve. The caller must
+// hold mu.
+func (s *Server) addDashboardName() {
+	if err := s.names.Add(s.dashboardDomain); err != nil {
+		log.Printf("Failed to add name entry for %s: %v", s.dashboardDomain, err)
+	}
 }
 
 // handleRequest handles incoming HTTP requests
 func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
-	s.mu.RLock()
-	target, ok := s.routes[r.Host]
-	s.mu.RUnlock()
+	host := canonicalHost(hostOnly(r.Host))
+	if host == s.dashboardHost() {
+		s.dashboard.ServeHTTP(w, r)
+		return
+	}
 
+	rt, _, label, ok := s.lookupRoute(host)
 	if !ok {
-		http.Error(w, "No route configured for "+r.Host, http.StatusNotFound)
+		http.Error(w, "No route configured for "+host, http.StatusNotFound)
 		return
 	}
 
-	// Parse target URL
-	targetURL, err := url.Parse("http://" + target)
-	if err != nil {
-		http.Error(w, "Invalid target URL", http.StatusInternalServerError)
+	t := rt.match(r.URL.Path)
+	if t == nil {
+		http.Error(w, "No route configured for "+host+r.URL.Path, http.StatusNotFound)
 		return
 	}
 
-	// Create reverse proxy
-	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	// Capture the exchange under the route's primary name
+	name := rt.names[0]
+	ex := s.captures.Begin(name, r)
+	rec := inspect.NewRecorder(w)
+	defer s.captures.Finish(ex, rec)
+	ctx := inspect.WithExchange(r.Context(), ex)
+	r = r.WithContext(httptrace.WithClientTrace(ctx, ex.Trace()))
 
 	// Modify request
-	r.URL.Host = targetURL.Host
-	r.URL.Scheme = targetURL.Scheme
+	if t.strip {
+		t.stripPrefix(r.URL)
+	}
 	r.Header.Set("X-Forwarded-Host", r.Host)
 	r.Header.Set("X-Forwarded-Proto", "https")
+	if t.subdomainHeader != "" {
+		r.Header.Set(t.subdomainHeader, label)
+	}
+
+	// Only ask for encodings both the client and the body rewriter accept
+	if t.rewrite != nil && t.rewrite.body && r.Header.Get("Accept-Encoding") != "" {
+		if enc := acceptEncoding(r.Header.Get("Accept-Encoding")); enc != "" {
+			r.Header.Set("Accept-Encoding", enc)
+		} else {
+			r.Header.Set("Accept-Encoding", "identity")
+		}
+	}
+
+	// Apply the route's header rules
+	vars := headerVars(r, name)
+	applyHeaderRules(r.Header, t.headers.request, vars)
+	r = r.WithContext(withHeaderVars(r.Context(), vars))
+	ex.Upstream = "http://" + t.host + r.URL.RequestURI()
 
 	// Serve the request
-	proxy.ServeHTTP(w, r)
+	t.proxy.ServeHTTP(rec, r)
 }
 
 // Stop stops the proxy server
 func (s *Server) Stop() error {
+	select {
+	case <-s.done:
+	default:
+		close(s.done)
+	}
+
+	s.lmu.Lock()
+	s.closeListeners()
+	s.stopDNS()
+	s.lmu.Unlock()
+
+	if s.redirect != nil {
+		s.redirect.Close()
+	}
 	if s.server != nil {
 		return s.server.Close()
 	}
 	return nil
 }
+
+// newRoute builds the target list for a mapping. The mapping's own port
+// serves every path not claimed by a more specific rule. publicPort is the
+// HTTPS port browsers use, or "" for the default.
+func newRoute(mapping config.ProxyMapping, publicPort string) *route {
+	rt := &route{names: mapping.Hostnames()}
+
+	for _, p := range mapping.Paths {
+		rt.targets = append(rt.targets, newTarget(mapping, p, publicPort))
+	}
+
+	if mapping.LocalPort != "" {
+		rt.targets = append(rt.targets, newTarget(mapping, config.PathRule{
+			LocalPort:  mapping.LocalPort,
+			HealthPath: mapping.HealthPath,
+		}, publicPort))
+	}
+
+	// Longest prefix first; stable so config order breaks ties
+	sort.SliceStable(rt.targets, func(i, j int) bool {
+		return len(rt.targets[i].prefix) > len(rt.targets[j].prefix)
+	})
+
+	return rt
+}
+
+// newTarget builds a target with its own reverse proxy and connection pool,
+// so keep-alive connections to one dev server are reused across requests
+func newTarget(mapping config.ProxyMapping, rule config.PathRule, publicPort string) target {
+	// Validated by config.SetRetryGrace; a hand-edited bad value disables holding
+	grace, _ := time.ParseDuration(mapping.RetryGrace)
+
+	t := target{
+		domain:     mapping.FullDomain,
+		prefix:     strings.TrimSuffix(rule.Prefix, "/"),
+		strip:      rule.StripPrefix,
+		host:       "localhost:" + rule.LocalPort,
+		port:       rule.LocalPort,
+		healthPath: rule.HealthPath,
+		headers:    newHeaderRules(mapping.Headers),
+		health:     &healthState{},
+		transport:  newTransport(grace),
+	}
+
+	if slices.ContainsFunc(mapping.Hostnames(), config.IsWildcard) {
+		t.subdomainHeader = mapping.SubdomainHeader
+		if t.subdomainHeader == "" {
+			t.subdomainHeader = config.DefaultSubdomainHeader
+		}
+	}
+
+	if mapping.Rewrite != config.RewriteOff {
+		t.rewrite = newOriginRewriter(mapping.FullDomain, rule.LocalPort, publicPort, mapping.Rewrite == config.RewriteBody)
+	}
+
+	t.proxy = httputil.NewSingleHostReverseProxy(&url.URL{Scheme: "http", Host: t.host})
+	t.proxy.Transport = t.transport
+	t.proxy.ErrorHandler = t.handleError
+	t.proxy.ModifyResponse = t.modifyResponse
+
+	return t
+}
+
+// newTransport returns a transport tuned for a single local upstream. Dev
+// servers serve many small requests per page load, so the idle pool is
+// sized for one host rather than spread across many. A non-zero grace
+// holds requests while the upstream refuses connections.
+func newTransport(grace time.Duration) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+
+	dial := dialer.DialContext
+	if grace > 0 {
+		dial = dialWithRetry(dial, grace)
+	}
+
+	return &http.Transport{
+		DialContext:           dial,
+		MaxIdleConns:          256,
+		MaxIdleConnsPerHost:   256,
+		IdleConnTimeout:       90 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// modifyResponse rewrites the upstream response before it is sent back
+func (t *target) modifyResponse(resp *http.Response) error {
+	vars := headerVarsFromContext(resp.Request.Context())
+
+	// The public origin is whichever alias or subdomain was requested
+	rewrite := t.rewrite
+	if rewrite != nil && resp.Request.Host != "" {
+		rewrite = rewrite.forHost(resp.Request.Host)
+	}
+
+	if rewrite != nil {
+		rewrite.rewriteHeaders(resp.Header)
+	}
+	applyHeaderRules(resp.Header, t.headers.response, vars)
+
+	if rewrite != nil && rewrite.body {
+		return rewrite.rewriteBody(resp)
+	}
+	return nil
+}
+
+// close releases the idle upstream connections held by the route
+func (rt *route) close() {
+	for i := range rt.targets {
+		rt.targets[i].transport.CloseIdleConnections()
+	}
+}
+
+// match returns the target with the longest prefix matching path
+func (rt *route) match(path string) *target {
+	for i := range rt.targets {
+		if rt.targets[i].matches(path) {
+			return &rt.targets[i]
+		}
+	}
+	return nil
+}
+
+// matches reports whether path falls under the target's prefix on a
+// segment boundary, so /api matches /api and /api/users but not /apix
+func (t *target) matches(path string) bool {
+	if t.prefix == "" {
+		return true
+	}
+	return path == t.prefix || strings.HasPrefix(path, t.prefix+"/")
+}
+
+// stripPrefix removes the target's prefix from the request URL
+func (t *target) stripPrefix(u *url.URL) {
+	u.Path = strings.TrimPrefix(u.Path, t.prefix)
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	if u.RawPath != "" {
+		u.RawPath = strings.TrimPrefix(u.RawPath, t.prefix)
+		if u.RawPath == "" {
+			u.RawPath = "/"
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"github.com/doganarif/blast/internal/ca"
+)
+
+// TestMain points the state directory at a temporary one. It is resolved
+// once per process, so the whole package shares it.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "blast-proxy-test-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("BLAST_HOME", dir)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// newTestServer returns a server whose issued certificates are stored in
+// a directory of their own, returned alongside it
+func newTestServer(t testing.TB) (*Server, string) {
+	t.Helper()
+
+	rootCA, err := ca.EnsureCA()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testCA := *rootCA
+	testCA.Path = t.TempDir()
+	return NewServer(&testCA), testCA.Path
+}
+
+// newUpstream starts a dev server stand-in. It returns the port and a
+// counter of the connections it accepted.
+func newUpstream(t testing.TB) (string, *atomic.Int64) {
+	t.Helper()
+
+	var conns atomic.Int64
+	upstream := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	upstream.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	upstream.Start()
+	t.Cleanup(upstream.Close)
+
+	_, port, err := net.SplitHostPort(upstream.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return port, &conns
+}
+
+// BenchmarkHandleRequest compares proxying through a route's own reverse
+// proxy and transport against building a reverse proxy for every request,
+// as earlier versions did. Both look the route up the same way; the
+// inspector and header rules are left out so only the proxying differs.
+// Besides time per request it reports upstream connections per request.
+func BenchmarkHandleRequest(b *testing.B) {
+	port, conns := newUpstream(b)
+
+	s, _ := newTestServer(b)
+	if err := s.AddRoute("app.blast", port); err != nil {
+		b.Fatal(err)
+	}
+	lookup := func(r *http.Request) *target {
+		rt, _, _, ok := s.lookupRoute(hostOnly(r.Host))
+		if !ok {
+			b.Fatalf("no route for %s", r.Host)
+		}
+		return rt.match(r.URL.Path)
+	}
+
+	b.Run("PerRoute", func(b *testing.B) {
+		benchmarkHandler(b, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lookup(r).proxy.ServeHTTP(w, r)
+		}), conns)
+	})
+
+	b.Run("PerRequest", func(b *testing.B) {
+		benchmarkHandler(b, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			targetURL, err := url.Parse("http://" + lookup(r).host)
+			if err != nil {
+				http.Error(w, "Invalid target URL", http.StatusInternalServerError)
+				return
+			}
+			httputil.NewSingleHostReverseProxy(targetURL).ServeHTTP(w, r)
+		}), conns)
+	})
+}
+
+// benchmarkHandler sends parallel requests for app.blast through h
+func benchmarkHandler(b *testing.B, h http.Handler, conns *atomic.Int64) {
+	start := conns.Load()
+	b.ReportAllocs()
+	b.SetParallelism(16)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r := httptest.NewRequest(http.MethodGet, "https://app.blast/", nil)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != http.StatusOK {
+				b.Fatalf("status %d: %s", w.Code, w.Body)
+			}
+		}
+	})
+	b.ReportMetric(float64(conns.Load()-start)/float64(b.N), "dials/op")
+}
@@ -0,0 +1,30 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+)
+
+// handleRedirect sends plain HTTP requests for known hosts to HTTPS
+func (s *Server) handleRedirect(w http.ResponseWriter, r *http.Request) {
+	host := canonicalHost(hostOnly(r.Host))
+
+	_, _, _, known := s.lookupRoute(host)
+
+	if !known && host != s.dashboardHost() {
+		http.Error(w, "Blast has no route for "+host+". Run 'blast list' to see configured domains.", http.StatusNotFound)
+		return
+	}
+
+	// 301 is cached and followed by everything for GET; 308 keeps the
+	// method and body for everything else
+	code := http.StatusMovedPermanently
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		code = http.StatusPermanentRedirect
+	}
+
+	if port := s.publicPort(); port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), code)
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/doganarif/blast/internal/cert"
+)
+
+// renewInterval is how often certificates are checked for expiry
+const renewInterval = 12 * time.Hour
+
+// renewCerts reissues certificates close to expiry until the server stops
+func (s *Server) renewCerts() {
+	ticker := time.NewTicker(renewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.renewDue()
+		}
+	}
+}
+
+// renewDue reissues every issued certificate that is due for renewal.
+// Handshakes keep using the old certificate until the new one is ready.
+func (s *Server) renewDue() {
+	s.mu.RLock()
+	var due []*route
+	for domain, rt := range s.routes {
+		if domain == rt.names[0] && rt.cert != nil && cert.NeedsRenewal(*rt.cert) {
+			due = append(due, rt)
+		}
+	}
+	dashboard, dashboardDue := s.dashboardDomain, cert.NeedsRenewal(s.dashboardCert)
+	s.mu.RUnlock()
+
+	for _, rt := range due {
+		if _, err := s.issueCert(context.Background(), rt); err == nil {
+			log.Printf("Renewed certificate for %s", rt.names[0])
+		}
+	}
+
+	if dashboardDue {
+		tlsCert, err := s.store.Get(dashboard)
+		if err != nil {
+			log.Printf("Failed to renew certificate for %s: %v", dashboard, err)
+			return
+		}
+
+		// The inspector may have moved to another TLD meanwhile
+		s.mu.Lock()
+		if s.dashboardDomain == dashboard {
+			s.dashboardCert = tlsCert
+		}
+		s.mu.Unlock()
+		log.Printf("Renewed certificate for %s", dashboard)
+	}
+}
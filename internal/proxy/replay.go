@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/doganarif/blast/internal/inspect"
+)
+
+// ReplayOptions are edits applied to a captured request before it is resent
+type ReplayOptions struct {
+	Header        http.Header `json:"header,omitempty"`         // replaces these headers
+	RemoveHeaders []string    `json:"remove_headers,omitempty"` // drops these headers
+	Body          *string     `json:"body,omitempty"`           // replaces the body when set
+}
+
+// Replay resends a captured request through its route's reverse proxy. The
+// new exchange is captured like any other, linked to the original through
+// ReplayOf, and returned. The replay is abandoned when ctx is done.
+func (s *Server) Replay(ctx context.Context, original *inspect.Exchange, opts ReplayOptions) (*inspect.Exchange, error) {
+	body := original.RequestBody
+	if opts.Body != nil {
+		body = []byte(*opts.Body)
+	} else if original.RequestBodyTruncated {
+		return nil, fmt.Errorf("request body of exchange %d was truncated; provide a body to replay it", original.ID)
+	} else if original.RequestBodyUnread {
+		return nil, fmt.Errorf("request body of exchange %d was not fully read by the upstream; provide a body to replay it", original.ID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, original.Method, original.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build replay request: %w", err)
+	}
+
+	req.Header = original.RequestHeader.Clone()
+	for name, values := range opts.Header {
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	for _, name := range opts.RemoveHeaders {
+		req.Header.Del(name)
+	}
+	if len(body) == 0 {
+		req.Body = http.NoBody
+	}
+	req.RemoteAddr = "127.0.0.1:0"
+
+	rp := &inspect.Replay{Original: original}
+	rw := &replayWriter{header: make(http.Header)}
+	s.handleRequest(rw, req.WithContext(inspect.WithReplay(req.Context(), rp)))
+
+	if rp.Exchange == nil {
+		return nil, fmt.Errorf("no route configured for %s", req.Host)
+	}
+	return rp.Exchange, nil
+}
+
+// handleReplay replays an exchange and returns the new one as JSON
+func (s *Server) handleReplay(w http.ResponseWriter, r *http.Request) {
+	original, ok := s.exchangeFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	var opts ReplayOptions
+	if err := json.NewDecoder(r.Body).Decode(&opts); err != nil && err != io.EOF {
+		http.Error(w, "Invalid replay options: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ex, err := s.Replay(r.Context(), original, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, ex)
+}
+
+// handleReplayPage replays an exchange unchanged from the dashboard and
+// shows the original with its replays
+func (s *Server) handleReplayPage(w http.ResponseWriter, r *http.Request) {
+	original, ok := s.exchangeFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := s.Replay(r.Context(), original, ReplayOptions{}); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	http.Redirect(w, r, "/exchanges/"+strconv.FormatUint(original.ID, 10), http.StatusSeeOther)
+}
+
+// replayWriter discards the replayed response; it is read from the capture
+type replayWriter struct {
+	header http.Header
+}
+
+// Header implements http.ResponseWriter
+func (rw *replayWriter) Header() http.Header {
+	return rw.header
+}
+
+// Write implements http.ResponseWriter
+func (rw *replayWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// WriteHeader implements http.ResponseWriter
+func (rw *replayWriter) WriteHeader(int) {}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/doganarif/blast/internal/inspect"
+)
+
+// TestReplayRefusesUnreadBody checks that a request whose body never
+// reached the upstream isn't replayed with an empty body
+func TestReplayRefusesUnreadBody(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/read" {
+			io.Copy(io.Discard, r.Body)
+		}
+		// Answering without reading makes the transport skip the body
+		// of an Expect: 100-continue request
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer upstream.Close()
+	_, port, _ := net.SplitHostPort(upstream.Listener.Addr().String())
+
+	s, _ := newTestServer(t)
+	if err := s.AddRoute("app.blast", port); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, wantErr := range map[string]bool{"/skip": true, "/read": false} {
+		r := httptest.NewRequest(http.MethodPost, "https://app.blast"+path, strings.NewReader(`{"name":"blast"}`))
+		r.Header.Set("Expect", "100-continue")
+		s.handleRequest(httptest.NewRecorder(), r)
+
+		exchanges := s.captures.List(inspect.Filter{Route: "app.blast"})
+		original := exchanges[0]
+		if original.RequestBodyUnread != wantErr {
+			t.Errorf("%s: RequestBodyUnread = %v, want %v", path, original.RequestBodyUnread, wantErr)
+		}
+
+		_, err := s.Replay(context.Background(), original, ReplayOptions{})
+		if (err != nil) != wantErr {
+			t.Errorf("%s: replay error %v, want error %v", path, err, wantErr)
+		}
+	}
+}
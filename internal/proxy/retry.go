@@ -0,0 +1,44 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+const retryInterval = 100 * time.Millisecond
+
+// dialFunc matches http.Transport.DialContext
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// dialWithRetry keeps redialing an upstream that refuses connections until
+// grace has elapsed, so requests that arrive while a dev server restarts
+// wait for it instead of failing. Once grace runs out the last dial error
+// is returned and the reverse proxy serves the error page.
+func dialWithRetry(dial dialFunc, grace time.Duration) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		deadline := time.Now().Add(grace)
+
+		for {
+			conn, err := dial(ctx, network, addr)
+			if err == nil {
+				return conn, nil
+			}
+
+			// The client went away; stop holding the request
+			if ctx.Err() != nil {
+				return nil, err
+			}
+
+			if time.Now().Add(retryInterval).After(deadline) {
+				return nil, err
+			}
+
+			select {
+			case <-ctx.Done():
+				return nil, err
+			case <-time.After(retryInterval):
+			}
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// originRewriter maps URLs pointing at a route's upstream, such as
+// http://localhost:3000/login, back to the route's public HTTPS origin
+type originRewriter struct {
+	domain     string
+	port       string // upstream port
+	publicHost string // host of the public origin, e.g. app.blast or app.blast:8443
+	body       bool   // also rewrite text bodies
+}
+
+// newOriginRewriter creates a rewriter for an upstream port on a domain.
+// publicPort is the HTTPS port browsers use, or "" for the default.
+func newOriginRewriter(domain, port, publicPort string, body bool) *originRewriter {
+	publicHost := domain
+	if publicPort != "" {
+		publicHost = net.JoinHostPort(domain, publicPort)
+	}
+
+	return &originRewriter{
+		domain:     domain,
+		port:       port,
+		publicHost: publicHost,
+		body:       body,
+	}
+}
+
+// forHost returns a copy of the rewriter for a public host, such as the
+// subdomain a wildcard route was reached on. host may include a port.
+func (o *originRewriter) forHost(host string) *originRewriter {
+	c := *o
+	c.domain = hostOnly(host)
+	c.publicHost = host
+	return &c
+}
+
+// isLoopback reports whether host names the local machine
+func isLoopback(host string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// rewriteURL maps an absolute upstream URL to the public origin. Relative
+// URLs and URLs for other hosts are returned unchanged.
+func (o *originRewriter) rewriteURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || !isLoopback(u.Hostname()) || u.Port() != o.port {
+		return raw
+	}
+
+	u.Scheme = "https"
+	u.Host = o.publicHost
+	return u.String()
+}
+
+// rewriteHeaders rewrites redirect targets and cookies in an upstream response
+func (o *originRewriter) rewriteHeaders(h http.Header) {
+	for _, name := range []string{"Location", "Content-Location"} {
+		if v := h.Get(name); v != "" {
+			h.Set(name, o.rewriteURL(v))
+		}
+	}
+
+	if v := h.Get("Refresh"); v != "" {
+		h.Set("Refresh", o.rewriteRefresh(v))
+	}
+
+	if cookies := h.Values("Set-Cookie"); len(cookies) > 0 {
+		h.Del("Set-Cookie")
+		for _, line := range cookies {
+			h.Add("Set-Cookie", o.rewriteCookie(line))
+		}
+	}
+}
+
+// rewriteRefresh rewrites the URL in a "5; url=http://localhost:3000/"
+// Refresh header
+func (o *originRewriter) rewriteRefresh(v string) string {
+	i := strings.Index(strings.ToLower(v), "url=")
+	if i < 0 {
+		return v
+	}
+
+	target := strings.Trim(strings.TrimSpace(v[i+len("url="):]), `'"`)
+	return v[:i+len("url=")] + o.rewriteURL(target)
+}
+
+// rewriteCookie moves a localhost cookie onto the public domain and marks
+// every cookie Secure, since the browser only talks HTTPS to Blast
+func (o *originRewriter) rewriteCookie(line string) string {
+	c, err := http.ParseSetCookie(line)
+	if err != nil {
+		return line
+	}
+
+	if c.Domain != "" && isLoopback(strings.TrimPrefix(c.Domain, ".")) {
+		c.Domain = o.domain
+	}
+	c.Secure = true
+
+	if s := c.String(); s != "" {
+		return s
+	}
+	return line
+}
@@ -0,0 +1,39 @@
+package proxy
+
+import "strings"
+
+// matchHost finds the configured name serving host: the host itself, or
+// a wildcard route covering its first label, such as *.app.blast for
+// acme.app.blast. For wildcard matches it also returns the label.
+func matchHost(host string, known func(string) bool) (name, label string, ok bool) {
+	if known(host) {
+		return host, "", true
+	}
+
+	label, rest, found := strings.Cut(host, ".")
+	if !found || label == "" || label == "*" {
+		return "", "", false
+	}
+
+	wildcard := "*." + rest
+	if known(wildcard) {
+		return wildcard, label, true
+	}
+	return "", "", false
+}
+
+// lookupRoute returns the route serving host, its configured name and the
+// label matched by a wildcard route
+func (s *Server) lookupRoute(host string) (rt *route, name, label string, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	name, label, ok = matchHost(host, func(name string) bool {
+		_, ok := s.routes[name]
+		return ok
+	})
+	if !ok {
+		return nil, "", "", false
+	}
+	return s.routes[name], name, label, true
+}
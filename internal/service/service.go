@@ -0,0 +1,80 @@
+package service
+
+import (
+	"bytes"
+	"net"
+	"text/template"
+)
+
+const (
+	socketUnit  = "blast.socket"
+	serviceUnit = "blast.service"
+)
+
+// Options describe the systemd unit pair for the daemon
+type Options struct {
+	Executable string
+	User       string
+	Group      string
+	Home       string
+	Addresses  []string // "" listens on all interfaces
+	Ports      []string // HTTPS first, then HTTP if enabled
+}
+
+// ListenStreams returns the ListenStream= values for every address and port
+func (o Options) ListenStreams() []string {
+	var streams []string
+	for _, addr := range o.Addresses {
+		for _, port := range o.Ports {
+			if addr == "" {
+				streams = append(streams, port)
+			} else {
+				streams = append(streams, net.JoinHostPort(addr, port))
+			}
+		}
+	}
+	return streams
+}
+
+// Units renders the socket and service unit files
+func Units(opts Options) (socket, service []byte, err error) {
+	var sb, svc bytes.Buffer
+	if err := socketTemplate.Execute(&sb, opts); err != nil {
+		return nil, nil, err
+	}
+	if err := serviceTemplate.Execute(&svc, opts); err != nil {
+		return nil, nil, err
+	}
+	return sb.Bytes(), svc.Bytes(), nil
+}
+
+var socketTemplate = template.Must(template.New("socket").Parse(`[Unit]
+Description=Blast HTTPS reverse proxy sockets
+
+[Socket]
+{{- range .ListenStreams}}
+ListenStream={{.}}
+{{- end}}
+NoDelay=true
+
+[Install]
+WantedBy=sockets.target
+`))
+
+var serviceTemplate = template.Must(template.New("service").Parse(`[Unit]
+Description=Blast HTTPS reverse proxy
+Requires=blast.socket
+After=blast.socket network.target
+
+[Service]
+ExecStart={{.Executable}} daemon
+ExecReload=/bin/kill -HUP $MAINPID
+User={{.User}}
+Group={{.Group}}
+Environment=HOME={{.Home}}
+Restart=on-failure
+NoNewPrivileges=true
+
+[Install]
+WantedBy=multi-user.target
+`))
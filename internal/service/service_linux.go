@@ -0,0 +1,97 @@
+//go:build linux
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+
+	"github.com/doganarif/blast/internal/config"
+	"github.com/doganarif/blast/internal/system"
+)
+
+const unitDir = "/etc/systemd/system"
+
+// Install writes a socket and service unit pair and starts the socket.
+// systemd binds the privileged ports and hands them to the daemon, which
+// runs as the invoking user instead of root.
+func Install(cfg *config.Config) error {
+	opts, err := optionsFor(cfg)
+	if err != nil {
+		return err
+	}
+
+	socket, service, err := Units(opts)
+	if err != nil {
+		return fmt.Errorf("failed to render units: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(unitDir, socketUnit), socket, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", socketUnit, err)
+	}
+	if err := os.WriteFile(filepath.Join(unitDir, serviceUnit), service, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", serviceUnit, err)
+	}
+
+	if err := system.Systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	return system.Systemctl("enable", "--now", socketUnit)
+}
+
+// Uninstall stops the units and removes them
+func Uninstall() error {
+	// Units may already be stopped or missing
+	system.Systemctl("disable", "--now", socketUnit, serviceUnit)
+
+	for _, unit := range []string{socketUnit, serviceUnit} {
+		if err := os.Remove(filepath.Join(unitDir, unit)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", unit, err)
+		}
+	}
+
+	return system.Systemctl("daemon-reload")
+}
+
+// optionsFor builds unit options for the user who invoked blast, looking
+// through sudo to the real user
+func optionsFor(cfg *config.Config) (Options, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return Options{}, fmt.Errorf("failed to get executable path: %w", err)
+	}
+
+	u, err := invokingUser()
+	if err != nil {
+		return Options{}, fmt.Errorf("failed to look up user: %w", err)
+	}
+
+	g, err := user.LookupGroupId(u.Gid)
+	if err != nil {
+		return Options{}, fmt.Errorf("failed to look up group: %w", err)
+	}
+
+	ports := []string{cfg.GetHTTPSPort()}
+	if httpPort := cfg.GetHTTPPort(); httpPort != config.HTTPPortOff {
+		ports = append(ports, httpPort)
+	}
+
+	return Options{
+		Executable: exePath,
+		User:       u.Username,
+		Group:      g.Name,
+		Home:       u.HomeDir,
+		Addresses:  cfg.GetBindAddresses(),
+		Ports:      ports,
+	}, nil
+}
+
+// invokingUser returns the user behind sudo, or the current user
+func invokingUser() (*user.User, error) {
+	if name := os.Getenv("SUDO_USER"); name != "" {
+		return user.Lookup(name)
+	}
+	return user.Current()
+}
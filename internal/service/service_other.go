@@ -0,0 +1,19 @@
+//go:build !linux
+
+package service
+
+import (
+	"fmt"
+
+	"github.com/doganarif/blast/internal/config"
+)
+
+// Install is only supported on Linux, where systemd provides socket activation
+func Install(cfg *config.Config) error {
+	return fmt.Errorf("blast service install requires systemd on Linux")
+}
+
+// Uninstall is only supported on Linux
+func Uninstall() error {
+	return fmt.Errorf("blast service uninstall requires systemd on Linux")
+}
@@ -0,0 +1,12 @@
+//go:build unix
+
+package system
+
+import (
+	"syscall"
+)
+
+// closeOnExec marks an inherited descriptor so it isn't leaked to children
+func closeOnExec(fd int) {
+	syscall.CloseOnExec(fd)
+}
@@ -0,0 +1,6 @@
+//go:build windows
+
+package system
+
+// closeOnExec is a no-op; systemd socket activation doesn't exist on Windows
+func closeOnExec(fd int) {}
@@ -0,0 +1,22 @@
+package system
+
+import (
+	"os"
+	"strconv"
+)
+
+// SudoUser returns the uid and gid of the user who invoked sudo. It
+// reports false when the process wasn't started through sudo.
+func SudoUser() (uid, gid int, ok bool) {
+	uid, err := strconv.Atoi(os.Getenv("SUDO_UID"))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	gid, err = strconv.Atoi(os.Getenv("SUDO_GID"))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return uid, gid, true
+}
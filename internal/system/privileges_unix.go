@@ -3,10 +3,65 @@
 package system
 
 import (
+	"fmt"
 	"os"
+	"os/user"
+	"strconv"
+	"syscall"
 )
 
 // HasPrivileges returns true if running as root
 func HasPrivileges() bool {
 	return os.Geteuid() == 0
 }
+
+// droppedPrivileges records whether DropPrivileges switched users
+var droppedPrivileges bool
+
+// DropPrivileges switches the process from root to the user who invoked
+// sudo. The given paths, if they exist, are handed to that user first so
+// it can keep writing them. It does nothing unless running as root
+// through sudo.
+func DropPrivileges(writable ...string) error {
+	uid, gid, ok := SudoUser()
+	if !ok || os.Geteuid() != 0 || uid == 0 {
+		return nil
+	}
+
+	for _, path := range writable {
+		if err := os.Lchown(path, uid, gid); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to hand %s to uid %d: %w", path, uid, err)
+		}
+	}
+
+	// Supplementary groups first, while still root
+	groups := []int{gid}
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		if ids, err := u.GroupIds(); err == nil {
+			groups = groups[:0]
+			for _, id := range ids {
+				if g, err := strconv.Atoi(id); err == nil {
+					groups = append(groups, g)
+				}
+			}
+		}
+	}
+
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("setgroups: %w", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("setgid: %w", err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("setuid: %w", err)
+	}
+
+	droppedPrivileges = true
+	return nil
+}
+
+// PrivilegesDropped reports whether DropPrivileges switched users
+func PrivilegesDropped() bool {
+	return droppedPrivileges
+}
@@ -33,3 +33,13 @@ func HasPrivileges() bool {
 
 	return member
 }
+
+// DropPrivileges does nothing on Windows, where there is no sudo to return to
+func DropPrivileges(writable ...string) error {
+	return nil
+}
+
+// PrivilegesDropped always reports false on Windows
+func PrivilegesDropped() bool {
+	return false
+}
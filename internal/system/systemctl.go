@@ -0,0 +1,20 @@
+package system
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+)
+
+// Systemctl runs a systemctl command, including its stderr in the error
+func Systemctl(args ...string) error {
+	cmd := exec.Command("systemctl", args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl %v failed: %w (stderr: %s)", args, err, stderr.String())
+	}
+	return nil
+}